@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin checks the request's bearer token against the configured
+// admin token and writes an error response if it does not match. Admin
+// endpoints are disabled entirely when no token is configured.
+func (us *URLShortener) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if us.adminToken == "" {
+		http.Error(w, "Admin API is disabled", http.StatusForbidden)
+		return false
+	}
+	if !us.isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the request carries the admin token.
+func (us *URLShortener) isAdmin(r *http.Request) bool {
+	if us.adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(us.adminToken)) == 1
+}
@@ -0,0 +1,43 @@
+// The server only accepts state-changing requests that echo this cookie.
+function csrfToken() {
+    const match = document.cookie.match(/(?:^|; )csrf_token=([^;]*)/);
+    return match ? match[1] : '';
+}
+
+// show toggles an element with the hidden utility class.
+function show(el, visible) {
+    el.classList.toggle('hidden', !visible);
+}
+
+// copyText copies text to the clipboard and calls done(true), then
+// done(false) two seconds later, so callers can flash a confirmation.
+async function copyText(text, done) {
+    try {
+        await navigator.clipboard.writeText(text);
+        done(true);
+        setTimeout(() => done(false), 2000);
+    } catch (err) {
+        console.error('Failed to copy:', err);
+    }
+}
+
+// shareLink opens the system share sheet with the title and text from the
+// page's data-share-title and data-share-text, or copies the URL where
+// sharing is not supported.
+async function shareLink(root, url, done) {
+    if (!navigator.share) {
+        await copyText(url, done);
+        return;
+    }
+    try {
+        await navigator.share({
+            title: root.dataset.shareTitle,
+            text: root.dataset.shareText,
+            url: url
+        });
+    } catch (err) {
+        if (err.name !== 'AbortError') {
+            console.error('Error sharing:', err);
+        }
+    }
+}
@@ -0,0 +1,89 @@
+(function () {
+    const app = document.getElementById('history-app');
+    const helpModal = document.getElementById('help-modal');
+    const deleteModal = document.getElementById('delete-modal');
+    const deleteError = document.getElementById('delete-error');
+    let deleting = null; // the delete button of the link awaiting confirmation
+
+    // Favicons come from the linked sites and may fail to load, possibly
+    // before this runs, so images that already failed are hidden too.
+    app.querySelectorAll('img[data-favicon]').forEach(img => {
+        const hide = () => show(img, false);
+        if (img.complete && img.naturalWidth === 0) {
+            hide();
+        } else {
+            img.addEventListener('error', hide);
+        }
+    });
+
+    document.getElementById('help').addEventListener('click', () => show(helpModal, true));
+    document.getElementById('help-close').addEventListener('click', () => show(helpModal, false));
+
+    // shortUrl is the short URL in the data-url attribute of a button.
+    function shortUrl(button) {
+        return window.location.protocol + button.dataset.url;
+    }
+
+    function copied(button) {
+        return success => {
+            button.classList.toggle('text-green-400', success);
+            button.classList.toggle('text-blue-400', !success);
+            show(button.querySelector('[data-icon="copy"]'), !success);
+            show(button.querySelector('[data-icon="copied"]'), success);
+        };
+    }
+
+    function setDeleting(button, busy) {
+        button.disabled = busy;
+        show(button.querySelector('[data-label="busy"]'), busy);
+        show(button.querySelector('[data-label="idle"]'), !busy);
+    }
+
+    app.querySelectorAll('button[data-action]').forEach(button => {
+        button.addEventListener('click', () => {
+            switch (button.dataset.action) {
+            case 'copy':
+                copyText(shortUrl(button), copied(button));
+                break;
+            case 'share':
+                shareLink(app, shortUrl(button), copied(button));
+                break;
+            case 'delete':
+                deleting = button;
+                show(deleteModal, true);
+                break;
+            }
+        });
+    });
+
+    document.getElementById('delete-cancel').addEventListener('click', () => {
+        deleting = null;
+        show(deleteModal, false);
+        show(deleteError, false);
+    });
+
+    document.getElementById('delete-confirm').addEventListener('click', async () => {
+        if (!deleting) return;
+
+        const button = deleting;
+        setDeleting(button, true);
+        try {
+            const domain = button.dataset.domain;
+            const query = domain ? '?domain=' + encodeURIComponent(domain) : '';
+            const response = await fetch('/delete/' + encodeURIComponent(button.dataset.code) + query, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() }
+            });
+
+            if (!response.ok) throw new Error('Failed to delete URL');
+
+            window.location.reload(); // Refresh to get updated list
+        } catch (error) {
+            console.error('Delete error:', error);
+            deleteError.textContent = app.dataset.deleteError;
+            show(deleteError, true);
+        } finally {
+            setDeleting(button, false);
+        }
+    });
+})();
@@ -0,0 +1,132 @@
+(function () {
+    const app = document.getElementById('app');
+    const input = document.getElementById('url');
+    const invalid = document.getElementById('url-invalid');
+    const result = document.getElementById('result');
+    const link = document.getElementById('short-url');
+    const copyButton = document.getElementById('copy');
+    const copyTitle = copyButton.title;
+    let urlTimer;
+
+    function isValidUrl(url) {
+        try {
+            // Try to construct a URL object
+            const urlObj = new URL(url);
+            // Check if protocol is http or https
+            if (urlObj.protocol !== 'http:' && urlObj.protocol !== 'https:') {
+                return false;
+            }
+            // Additional validation for minimum domain length
+            const hostParts = urlObj.hostname.split('.');
+            return hostParts.length >= 2 && !hostParts.some(part => part.length === 0);
+        } catch {
+            return false;
+        }
+    }
+
+    // validateUrl colors the input and picks its icon.
+    function validateUrl() {
+        const url = input.value;
+        const valid = url !== '' && isValidUrl(url);
+        const state = url === '' ? 'empty' : (valid ? 'valid' : 'invalid');
+        input.classList.toggle('border-gray-700', state === 'empty');
+        input.classList.toggle('border-green-500', state === 'valid');
+        input.classList.toggle('focus:ring-green-500', state === 'valid');
+        input.classList.toggle('border-red-500', state === 'invalid');
+        input.classList.toggle('focus:ring-red-500', state === 'invalid');
+        app.querySelectorAll('svg[data-state]').forEach(icon => show(icon, icon.dataset.state === state));
+        show(invalid, state === 'invalid');
+        return valid;
+    }
+
+    function autoCorrectUrl() {
+        const url = input.value;
+        if (url && !url.startsWith('http://') && !url.startsWith('https://')) {
+            input.value = 'https://' + url;
+            validateUrl();
+        }
+    }
+
+    function copied(success) {
+        show(copyButton.querySelector('[data-icon="copy"]'), !success);
+        show(copyButton.querySelector('[data-icon="copied"]'), success);
+        show(document.getElementById('copied'), success);
+        copyButton.title = success ? copyButton.dataset.copiedTitle : copyTitle;
+    }
+
+    function showResult(shortUrl, ok) {
+        link.textContent = shortUrl;
+        if (ok) {
+            link.href = shortUrl;
+            document.getElementById('stats-link').href = '/stats/' + shortUrl.split('/').pop();
+        } else {
+            link.removeAttribute('href');
+        }
+        show(result, true);
+    }
+
+    async function shortenUrl() {
+        if (!validateUrl()) return;
+        try {
+            const response = await fetch('/shorten', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() },
+                body: JSON.stringify({ url: input.value })
+            });
+            if (!response.ok) {
+                showResult(app.dataset.shortenError, false);
+                return;
+            }
+            const data = await response.json();
+            showResult(data.short_url, true);
+            createParticles();
+        } catch (error) {
+            console.error(error);
+            showResult(app.dataset.shortenError, false);
+        }
+    }
+
+    function createParticles() {
+        const particles = 20;
+        for (let i = 0; i < particles; i++) {
+            setTimeout(() => {
+                const particle = document.createElement('div');
+                particle.className = 'particle';
+
+                const x = Math.random() * window.innerWidth;
+                const y = Math.random() * window.innerHeight;
+                const size = Math.random() * 3 + 1;
+                const tx = (Math.random() - 0.5) * 200;
+                const ty = (Math.random() - 0.5) * 200;
+
+                particle.style.cssText = 'left: ' + x + 'px;' +
+                    'top: ' + y + 'px;' +
+                    'width: ' + size + 'px;' +
+                    'height: ' + size + 'px;' +
+                    '--tx: ' + tx + 'px;' +
+                    '--ty: ' + ty + 'px;' +
+                    'animation: particle-animation 3s ease-in infinite;';
+
+                document.body.appendChild(particle);
+
+                setTimeout(() => {
+                    document.body.removeChild(particle);
+                }, 3000);
+            }, i * 200);
+        }
+    }
+
+    input.addEventListener('input', () => {
+        validateUrl();
+        // Auto-correct URL after a short delay when user stops typing
+        clearTimeout(urlTimer);
+        urlTimer = setTimeout(autoCorrectUrl, 1000);
+    });
+    // Allow paste event to complete before validation
+    input.addEventListener('paste', () => setTimeout(validateUrl, 0));
+    document.getElementById('shorten').addEventListener('click', shortenUrl);
+    copyButton.addEventListener('click', () => copyText(link.textContent, copied));
+    document.getElementById('share').addEventListener('click', () => shareLink(app, link.textContent, copied));
+
+    createParticles();
+})();
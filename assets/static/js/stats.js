@@ -0,0 +1,15 @@
+(function () {
+    const app = document.getElementById('stats-app');
+    const copyButton = document.getElementById('copy');
+    const shareButton = document.getElementById('share');
+
+    function copied(success) {
+        copyButton.classList.toggle('text-green-400', success);
+        copyButton.classList.toggle('text-gray-400', !success);
+        show(copyButton.querySelector('[data-icon="copy"]'), !success);
+        show(copyButton.querySelector('[data-icon="copied"]'), success);
+    }
+
+    copyButton.addEventListener('click', () => copyText(copyButton.dataset.url, copied));
+    shareButton.addEventListener('click', () => shareLink(app, shareButton.dataset.url, copied));
+})();
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Branding is how the pages present the service. Empty fields of a
+// domain's branding fall back to the instance's, and those to the built-in
+// look.
+type Branding struct {
+	SiteName        string `json:"site_name,omitempty"`
+	LogoURL         string `json:"logo_url,omitempty"`
+	FaviconURL      string `json:"favicon_url,omitempty"`
+	CanonicalURL    string `json:"canonical_url,omitempty"`
+	PrimaryColor    string `json:"primary_color,omitempty"`    // links, headings and buttons
+	BackgroundColor string `json:"background_color,omitempty"` // replaces the page gradient
+	// FooterText replaces the home page footer when set, linking to
+	// FooterURL if that is set too.
+	FooterText string `json:"footer_text,omitempty"`
+	FooterURL  string `json:"footer_url,omitempty"`
+}
+
+var defaultBranding = Branding{
+	SiteName:     "URL Shortener",
+	FaviconURL:   "https://pipeops.io/apple-touch-icon.png",
+	CanonicalURL: "https://url.pipeops.app/",
+}
+
+// brandColor accepts hex colors and CSS color names, which is all the
+// templates can safely put in a style sheet.
+var brandColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// validate checks the branding's URLs and colors.
+func (b *Branding) validate() error {
+	var errs []error
+	for name, s := range map[string]string{
+		"logo_url":      b.LogoURL,
+		"favicon_url":   b.FaviconURL,
+		"canonical_url": b.CanonicalURL,
+		"footer_url":    b.FooterURL,
+	} {
+		if s == "" || strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+			continue
+		}
+		if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid %s %q", name, s))
+		}
+	}
+	for name, s := range map[string]string{"primary_color": b.PrimaryColor, "background_color": b.BackgroundColor} {
+		if s != "" && !brandColor.MatchString(s) {
+			errs = append(errs, fmt.Errorf("invalid %s %q", name, s))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// merge returns b with the fields set in over replacing its own.
+func (b Branding) merge(over *Branding) Branding {
+	if over == nil {
+		return b
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&b.SiteName, &over.SiteName},
+		{&b.LogoURL, &over.LogoURL},
+		{&b.FaviconURL, &over.FaviconURL},
+		{&b.CanonicalURL, &over.CanonicalURL},
+		{&b.PrimaryColor, &over.PrimaryColor},
+		{&b.BackgroundColor, &over.BackgroundColor},
+		{&b.FooterText, &over.FooterText},
+		{&b.FooterURL, &over.FooterURL},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	return b
+}
+
+// SetBranding sets the instance's branding over the built-in one.
+func (us *URLShortener) SetBranding(b Branding) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	us.branding = defaultBranding.merge(&b)
+	us.mu.Unlock()
+	return nil
+}
+
+// brandingFor returns the branding of the pages served on a domain. A
+// branded domain without its own canonical URL points at its own root. The
+// caller must hold us.mu.
+func (us *URLShortener) brandingFor(domain string) Branding {
+	d, ok := us.domains[domain]
+	if !ok {
+		return us.branding
+	}
+	b := us.branding
+	b.CanonicalURL = d.baseURL() + "/"
+	return b.merge(d.Branding)
+}
+
+// requestBranding returns the branding for the host a request was made to.
+func (us *URLShortener) requestBranding(r *http.Request) Branding {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	return us.brandingFor(us.namespace(r.Host))
+}
+
+// pageNames are the page templates, each in a file of that name.
+var pageNames = []string{"home.html", "history.html", "stats.html", "preview.html", "error.html", "card.html"}
+
+// LoadTemplates replaces built-in page templates with same-named files
+// from dir, where present. Overrides are html/template files executed with
+// the same data as the page they replace, and can use the asset and
+// locales functions and the brand-head, brand-style, brand-logo and
+// brand-footer templates.
+func (us *URLShortener) LoadTemplates(dir string) error {
+	for _, name := range pageNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		tmpl, err := newPageTemplate(name).ParseFiles(path)
+		if err != nil {
+			return err
+		}
+		us.templates[name] = tmpl
+	}
+	return nil
+}
+
+// template returns a page template, overridden or built-in.
+func (us *URLShortener) template(name string) *template.Template {
+	if tmpl, ok := us.templates[name]; ok {
+		return tmpl
+	}
+	return pageTemplates[name]
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxBulkRows      = 1000
+	maxBulkBodyBytes = 10 << 20 // 10 MB
+)
+
+// bulkResult reports the outcome of a single row of a bulk request.
+type bulkResult struct {
+	Row      int    `json:"row"`
+	URL      string `json:"url"`
+	Alias    string `json:"alias,omitempty"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// bulkResponse is the JSON body returned by HandleBulkShorten.
+type bulkResponse struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// HandleBulkShorten creates many links in one request. It accepts a JSON
+// array of shorten requests, a text/csv body or a multipart upload with a
+// "file" field. CSV input needs a header row with a "url" column and may add
+// "alias", "title", "domain", "workspace", "folder", "expires_at" and "tags"
+// (separated by ';') columns.
+//
+// The batch is all-or-nothing: if any row is invalid nothing is created and
+// the per-row errors are returned with 422. Pass ?partial=true to create the
+// valid rows anyway. Results are JSON unless ?format=csv is given or the
+// client accepts text/csv.
+func (us *URLShortener) HandleBulkShorten(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
+
+	reqs, err := readBulkRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(reqs) == 0 {
+		http.Error(w, "No URLs provided", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > maxBulkRows {
+		http.Error(w, fmt.Sprintf("At most %d URLs per request", maxBulkRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+	partial := r.URL.Query().Get("partial") == "true"
+
+	// Validate every row before touching the store.
+	results := make([]bulkResult, len(reqs))
+	links := make([]*URLData, len(reqs))
+	for i, req := range reqs {
+		results[i] = bulkResult{Row: i + 1, URL: req.URL, Alias: req.Alias}
+		data, err := newURLData(req)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		links[i] = data
+	}
+
+	// Assign codes and insert under a single lock so the batch is created
+	// atomically with respect to other requests.
+	userInfo := us.newUserInfo(r)
+	resp := bulkResponse{Results: results}
+	us.mu.Lock()
+	keys := make([]linkKey, len(reqs))
+	aliases := make(map[linkKey]int)
+	for i, req := range reqs {
+		if links[i] == nil {
+			continue
+		}
+		domain, err := us.createDomain(req.Domain, r.Host)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := us.checkCreate(r, req.Workspace); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		keys[i] = linkKey{Domain: domain}
+		if req.Alias == "" {
+			continue
+		}
+		key := linkKey{Domain: domain, Code: req.Alias}
+		if prev, dup := aliases[key]; dup {
+			results[i].Error = fmt.Sprintf("alias %q is repeated from row %d", req.Alias, prev)
+			continue
+		}
+		if _, taken := us.store[key]; taken {
+			results[i].Error = fmt.Sprintf("alias %q is already taken", req.Alias)
+			continue
+		}
+		aliases[key] = i + 1
+		keys[i] = key
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			resp.Failed++
+		}
+	}
+	if resp.Failed == 0 || partial {
+		for i := range reqs {
+			if results[i].Error != "" {
+				continue
+			}
+			key := keys[i]
+			if key.Code == "" {
+				key, _ = us.assignCode(key.Domain, "")
+			}
+			us.insertLink(key, links[i], userInfo)
+			us.queueMetadata(key, links[i].LongURL)
+			us.emitLinkEvent(EventLinkCreated, key, links[i])
+			us.auditLink(r, AuditCreate, key, links[i])
+			results[i].ShortURL = us.shortURL(key)
+			resp.Created++
+		}
+	}
+	us.mu.Unlock()
+
+	status := http.StatusOK
+	if resp.Created == 0 && resp.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	if wantsCSV(r) {
+		writeBulkCSV(w, status, results)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readBulkRequest decodes the rows of a bulk request from JSON or CSV.
+func readBulkRequest(r *http.Request) ([]shortenRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return parseBulkCSV(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("multipart upload needs a \"file\" field")
+		}
+		defer file.Close()
+		return parseBulkCSV(file)
+	default:
+		var reqs []shortenRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			return nil, errors.New("Invalid JSON: expected an array of links")
+		}
+		return reqs, nil
+	}
+}
+
+// parseBulkCSV reads rows from a CSV file with a header row.
+func parseBulkCSV(r io.Reader) ([]shortenRequest, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("CSV must start with a header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("CSV header must include a \"url\" column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var reqs []shortenRequest
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		req := shortenRequest{
+			URL:       field(record, "url"),
+			Alias:     field(record, "alias"),
+			Title:     field(record, "title"),
+			Domain:    field(record, "domain"),
+			Workspace: field(record, "workspace"),
+			Folder:    field(record, "folder"),
+		}
+		if tags := field(record, "tags"); tags != "" {
+			req.Tags = strings.Split(tags, ";")
+		}
+		if expires := field(record, "expires_at"); expires != "" {
+			t, err := parseExpiry(expires)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", len(reqs)+1, err)
+			}
+			req.ExpiresAt = &t
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// parseExpiry accepts an RFC 3339 timestamp or a plain date.
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires_at %q, use RFC 3339 or YYYY-MM-DD", s)
+}
+
+// wantsCSV reports whether the client asked for CSV output.
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// writeBulkCSV exports bulk results, including the generated short URLs.
+func writeBulkCSV(w http.ResponseWriter, status int, results []bulkResult) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="short-urls.csv"`)
+	w.WriteHeader(status)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"row", "url", "alias", "short_url", "error"})
+	for _, res := range results {
+		cw.Write([]string{strconv.Itoa(res.Row), res.URL, res.Alias, res.ShortURL, res.Error})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runCommand runs a command-line subcommand against a running server's admin
+// API and returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "export":
+		return runExport(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "import-external":
+		return runExternalImport(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	return 2
+}
+
+// adminFlags registers the flags every admin subcommand shares.
+func adminFlags(fs *flag.FlagSet) (server, token *string) {
+	defaultServer := os.Getenv("SHORTENER_URL")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:8080"
+	}
+	server = fs.String("server", defaultServer, "base URL of the running shortener (env SHORTENER_URL)")
+	token = fs.String("token", os.Getenv("ADMIN_TOKEN"), "admin token (env ADMIN_TOKEN)")
+	return
+}
+
+// adminRequest sends an authenticated request to the admin API.
+func adminRequest(method, server, path, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	server, token := adminFlags(fs)
+	output := fs.String("o", "-", "file to write the export to")
+	fs.Parse(args)
+
+	resp, err := adminRequest(http.MethodGet, *server, "/admin/export", *token, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+	return 0
+}
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	server, token := adminFlags(fs)
+	conflict := fs.String("conflict", conflictSkip, "what to do with existing codes: skip, overwrite or rename")
+	dryRun := fs.Bool("dry-run", false, "report what would change without importing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: url-shortner import [flags] [file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	query := url.Values{"conflict": {*conflict}}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+	resp, err := adminRequest(http.MethodPost, *server, "/admin/import?"+query.Encode(), *token, in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var report importReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return 1
+	}
+	printImportReport(report)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runExternalImport(args []string) int {
+	fs := flag.NewFlagSet("import-external", flag.ExitOnError)
+	server, token := adminFlags(fs)
+	format := fs.String("format", formatCSV, "export format: "+formatCSV+" or "+formatYOURLSSQL)
+	domain := fs.String("domain", "", "registered domain to create the links on")
+	dryRun := fs.Bool("dry-run", false, "report what would change without importing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: url-shortner import-external [flags] [file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import-external:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	query := url.Values{"format": {*format}}
+	if *domain != "" {
+		query.Set("domain", *domain)
+	}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+	resp, err := adminRequest(http.MethodPost, *server, "/admin/import/external?"+query.Encode(), *token, in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import-external:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var report importReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Fprintln(os.Stderr, "import-external:", err)
+		return 1
+	}
+	printImportReport(report)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printImportReport prints a human-readable import summary.
+func printImportReport(report importReport) {
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was changed.")
+	}
+	if report.Domains > 0 {
+		fmt.Printf("Domains: %d\n", report.Domains)
+	}
+	if report.Workspaces > 0 {
+		fmt.Printf("Workspaces: %d\n", report.Workspaces)
+	}
+	if report.Webhooks > 0 {
+		fmt.Printf("Webhooks: %d\n", report.Webhooks)
+	}
+	fmt.Printf("Imported: %d\nSkipped: %d\nOverwritten: %d\nRenamed: %d\n",
+		report.Imported, report.Skipped, report.Overwritten, len(report.Renamed))
+	for _, r := range report.Renamed {
+		fmt.Printf("  %s -> %s (%s)\n", r.From, r.To, r.Reason)
+	}
+	for _, e := range report.Errors {
+		fmt.Printf("line %d: %s\n", e.Line, e.Error)
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the server configuration. Every setting is read from, in
+// increasing order of precedence, its default, the config file, its
+// environment variable and its command-line flag.
+type Config struct {
+	Port           string
+	MetricsAddr    string
+	TrustedProxies []string // reverse proxies whose X-Forwarded-For is believed
+	HTTP           serverConfig
+	RateLimit      int // links each client may create per minute, 0 for no limit
+
+	TLSCertFile    string
+	TLSKeyFile     string
+	HTTPPort       string // plain HTTP listener that redirects to HTTPS
+	HTTPServeLinks bool   // serve short links on HTTPPort instead of redirecting
+	HSTSMaxAge     time.Duration
+	CSP            string // Content-Security-Policy of every response
+
+	DataFile         string
+	SnapshotInterval time.Duration
+	GeoIPDB          string
+
+	Domain   string
+	Domains  []string // host or host=root-redirect-url
+	Fallback string
+
+	AdminToken string
+
+	ErrorPages   string
+	TemplatesDir string // page templates that replace the built-in ones
+	Branding     Branding
+
+	LogLevel      string
+	LogOutput     string
+	AuditLog      string
+	AuditLogLevel string
+	RedactIPs     bool
+
+	MetadataWorkers       int
+	MetadataAllowPrivate  bool
+	LinkCheckInterval     time.Duration
+	LinkCheckFailures     int
+	LinkCheckAllowPrivate bool
+
+	NotifyMilestones  []uint64
+	NotifySpikeFactor float64
+	NotifyWebhookURL  string
+	NotifyLog         bool
+	SMTP              SMTPNotifier
+}
+
+// defaultConfig returns the configuration used when nothing is set.
+func defaultConfig() *Config {
+	return &Config{
+		Port:              "8080",
+		HTTP:              defaultServerConfig,
+		HSTSMaxAge:        180 * 24 * time.Hour,
+		CSP:               defaultCSP,
+		SnapshotInterval:  time.Minute,
+		LogLevel:          "info",
+		AuditLogLevel:     "info",
+		MetadataWorkers:   2,
+		LinkCheckInterval: 6 * time.Hour,
+		LinkCheckFailures: defaultThreshold,
+		NotifyMilestones:  []uint64{1000},
+		NotifySpikeFactor: 50,
+	}
+}
+
+// configValue is a setting's value, settable from its text form.
+type configValue interface {
+	flag.Value
+	toml() string // the value as it would appear in a config file
+}
+
+// setting describes one configuration setting and where it is read from.
+type setting struct {
+	key    string // section.name in the config file
+	env    string
+	flag   string
+	usage  string
+	secret bool // masked when the configuration is printed
+	value  configValue
+}
+
+// settings binds every setting to its field in c.
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "server.port", env: "PORT", flag: "port", usage: "port to listen on", value: (*stringValue)(&c.Port)},
+		{key: "server.metrics_addr", env: "METRICS_ADDR", flag: "metrics-addr", usage: "separate address for /metrics, e.g. 127.0.0.1:9090", value: (*stringValue)(&c.MetricsAddr)},
+		{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", flag: "trusted-proxies", usage: "reverse proxy IPs or CIDR ranges whose X-Forwarded-For is believed, comma-separated", value: (*listValue)(&c.TrustedProxies)},
+
+		{key: "tls.cert_file", env: "TLS_CERT_FILE", flag: "tls-cert", usage: "certificate file, enables HTTPS on the port; reloaded when it changes", value: (*stringValue)(&c.TLSCertFile)},
+		{key: "tls.key_file", env: "TLS_KEY_FILE", flag: "tls-key", usage: "private key file for the certificate", value: (*stringValue)(&c.TLSKeyFile)},
+		{key: "tls.http_port", env: "TLS_HTTP_PORT", flag: "http-port", usage: "plain HTTP port that redirects to HTTPS", value: (*stringValue)(&c.HTTPPort)},
+		{key: "tls.http_serve_links", env: "TLS_HTTP_SERVE_LINKS", flag: "http-serve-links", usage: "serve short links on the HTTP port instead of redirecting them", value: (*boolValue)(&c.HTTPServeLinks)},
+		{key: "tls.hsts_max_age", env: "HSTS_MAX_AGE", flag: "hsts-max-age", usage: "Strict-Transport-Security max-age over HTTPS, 0 to disable", value: (*durationValue)(&c.HSTSMaxAge)},
+
+		{key: "security.content_security_policy", env: "CONTENT_SECURITY_POLICY", flag: "csp", usage: "Content-Security-Policy header, empty to omit", value: (*stringValue)(&c.CSP)},
+
+		{key: "limits.read_header_timeout", env: "READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "time allowed to read request headers", value: (*durationValue)(&c.HTTP.ReadHeaderTimeout)},
+		{key: "limits.read_timeout", env: "READ_TIMEOUT", flag: "read-timeout", usage: "time allowed to read a whole request", value: (*durationValue)(&c.HTTP.ReadTimeout)},
+		{key: "limits.write_timeout", env: "WRITE_TIMEOUT", flag: "write-timeout", usage: "time allowed to write a response", value: (*durationValue)(&c.HTTP.WriteTimeout)},
+		{key: "limits.idle_timeout", env: "IDLE_TIMEOUT", flag: "idle-timeout", usage: "how long keep-alive connections stay open", value: (*durationValue)(&c.HTTP.IdleTimeout)},
+		{key: "limits.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "how long to drain requests on shutdown", value: (*durationValue)(&c.HTTP.ShutdownTimeout)},
+		{key: "limits.max_header_bytes", env: "MAX_HEADER_BYTES", flag: "max-header-bytes", usage: "largest accepted request header", value: (*intValue)(&c.HTTP.MaxHeaderBytes)},
+		{key: "limits.rate_limit", env: "RATE_LIMIT", flag: "rate-limit", usage: "shorten requests each client may make per minute, 0 for no limit", value: (*intValue)(&c.RateLimit)},
+
+		{key: "storage.data_file", env: "DATA_FILE", flag: "data-file", usage: "file the store is saved to and loaded from", value: (*stringValue)(&c.DataFile)},
+		{key: "storage.snapshot_interval", env: "SNAPSHOT_INTERVAL", flag: "snapshot-interval", usage: "how often the store is saved", value: (*durationValue)(&c.SnapshotInterval)},
+		{key: "storage.geoip_db", env: "GEOIP_DB", flag: "geoip-db", usage: "country CSV database for geo rules", value: (*stringValue)(&c.GeoIPDB)},
+
+		{key: "domains.default", env: "DOMAIN", flag: "domain", usage: "default short domain", value: (*stringValue)(&c.Domain)},
+		{key: "domains.extra", env: "DOMAINS", flag: "domains", usage: "extra short domains, as host or host=root-url, comma-separated", value: (*listValue)(&c.Domains)},
+		{key: "domains.fallback_url", env: "FALLBACK_URL", flag: "fallback-url", usage: "where unavailable links on the default domain send visitors", value: (*stringValue)(&c.Fallback)},
+
+		{key: "auth.admin_token", env: "ADMIN_TOKEN", flag: "admin-token", usage: "bearer token for the admin API", secret: true, value: (*stringValue)(&c.AdminToken)},
+
+		{key: "templates.error_pages", env: "ERROR_PAGES", flag: "error-pages", usage: "directory with custom 404.html and 410.html", value: (*stringValue)(&c.ErrorPages)},
+		{key: "templates.dir", env: "TEMPLATES_DIR", flag: "templates-dir", usage: "directory with page templates that replace the built-in ones", value: (*stringValue)(&c.TemplatesDir)},
+
+		{key: "branding.site_name", env: "BRAND_SITE_NAME", flag: "brand-site-name", usage: "name shown in page titles and headings", value: (*stringValue)(&c.Branding.SiteName)},
+		{key: "branding.logo_url", env: "BRAND_LOGO_URL", flag: "brand-logo-url", usage: "logo shown above the home page heading", value: (*stringValue)(&c.Branding.LogoURL)},
+		{key: "branding.favicon_url", env: "BRAND_FAVICON_URL", flag: "brand-favicon-url", usage: "favicon and social sharing image", value: (*stringValue)(&c.Branding.FaviconURL)},
+		{key: "branding.canonical_url", env: "BRAND_CANONICAL_URL", flag: "brand-canonical-url", usage: "canonical URL of the pages", value: (*stringValue)(&c.Branding.CanonicalURL)},
+		{key: "branding.primary_color", env: "BRAND_PRIMARY_COLOR", flag: "brand-primary-color", usage: "color of links, headings and buttons, hex or CSS name", value: (*stringValue)(&c.Branding.PrimaryColor)},
+		{key: "branding.background_color", env: "BRAND_BACKGROUND_COLOR", flag: "brand-background-color", usage: "page background, hex or CSS name", value: (*stringValue)(&c.Branding.BackgroundColor)},
+		{key: "branding.footer_text", env: "BRAND_FOOTER_TEXT", flag: "brand-footer-text", usage: "home page footer text", value: (*stringValue)(&c.Branding.FooterText)},
+		{key: "branding.footer_url", env: "BRAND_FOOTER_URL", flag: "brand-footer-url", usage: "link for the footer text", value: (*stringValue)(&c.Branding.FooterURL)},
+
+		{key: "logging.level", env: "LOG_LEVEL", flag: "log-level", usage: "server and access log level", value: (*stringValue)(&c.LogLevel)},
+		{key: "logging.output", env: "LOG_OUTPUT", flag: "log-output", usage: "stderr, stdout, off or a file", value: (*stringValue)(&c.LogOutput)},
+		{key: "logging.audit_log", env: "AUDIT_LOG", flag: "audit-log", usage: "audit log destination: stderr, stdout, off or a file", value: (*stringValue)(&c.AuditLog)},
+		{key: "logging.audit_level", env: "AUDIT_LOG_LEVEL", flag: "audit-log-level", usage: "audit log level", value: (*stringValue)(&c.AuditLogLevel)},
+		{key: "logging.redact_ips", env: "LOG_REDACT_IPS", flag: "log-redact-ips", usage: "mask client IPs in logs", value: (*boolValue)(&c.RedactIPs)},
+
+		{key: "metadata.workers", env: "METADATA_WORKERS", flag: "metadata-workers", usage: "destination metadata fetchers, 0 to disable", value: (*intValue)(&c.MetadataWorkers)},
+		{key: "metadata.allow_private", env: "METADATA_ALLOW_PRIVATE", flag: "metadata-allow-private", usage: "let metadata fetches reach private addresses", value: (*boolValue)(&c.MetadataAllowPrivate)},
+		{key: "link_check.interval", env: "LINK_CHECK_INTERVAL", flag: "link-check-interval", usage: "how often destinations are checked, 0 to disable", value: (*durationValue)(&c.LinkCheckInterval)},
+		{key: "link_check.failures", env: "LINK_CHECK_FAILURES", flag: "link-check-failures", usage: "failed checks before a link is broken", value: (*intValue)(&c.LinkCheckFailures)},
+		{key: "link_check.allow_private", env: "LINK_CHECK_ALLOW_PRIVATE", flag: "link-check-allow-private", usage: "let checks reach private addresses instead of skipping them", value: (*boolValue)(&c.LinkCheckAllowPrivate)},
+
+		{key: "notify.milestones", env: "NOTIFY_MILESTONES", flag: "notify-milestones", usage: "click totals to announce, comma-separated", value: (*milestonesValue)(&c.NotifyMilestones)},
+		{key: "notify.spike_factor", env: "NOTIFY_SPIKE_FACTOR", flag: "notify-spike-factor", usage: "multiple of usual traffic that counts as a spike, 0 to disable", value: (*floatValue)(&c.NotifySpikeFactor)},
+		{key: "notify.webhook_url", env: "NOTIFY_WEBHOOK_URL", flag: "notify-webhook-url", usage: "URL notifications are posted to", value: (*stringValue)(&c.NotifyWebhookURL)},
+		{key: "notify.log", env: "NOTIFY_LOG", flag: "notify-log", usage: "write notifications to the server log", value: (*boolValue)(&c.NotifyLog)},
+		{key: "smtp.addr", env: "SMTP_ADDR", flag: "smtp-addr", usage: "mail server for notifications, host:port", value: (*stringValue)(&c.SMTP.Addr)},
+		{key: "smtp.from", env: "SMTP_FROM", flag: "smtp-from", usage: "notification sender", value: (*stringValue)(&c.SMTP.From)},
+		{key: "smtp.to", env: "SMTP_TO", flag: "smtp-to", usage: "notification recipients, comma-separated", value: (*listValue)(&c.SMTP.To)},
+		{key: "smtp.username", env: "SMTP_USERNAME", flag: "smtp-username", usage: "mail server user", value: (*stringValue)(&c.SMTP.Username)},
+		{key: "smtp.password", env: "SMTP_PASSWORD", flag: "smtp-password", usage: "mail server password", secret: true, value: (*stringValue)(&c.SMTP.Password)},
+	}
+}
+
+// LoadConfig reads the configuration. The config file is named by -config
+// or CONFIG_FILE. It returns flag.ErrHelp after printing usage for -h.
+func LoadConfig(args []string, stderr io.Writer) (cfg *Config, printConfig bool, err error) {
+	cfg = defaultConfig()
+	settings := cfg.settings()
+
+	// Flags are collected first and applied last, after the file they may
+	// name and the environment.
+	type flagValue struct {
+		s     setting
+		value string
+	}
+	var flags []flagValue
+	fs := flag.NewFlagSet("url-shortner", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "config file (env CONFIG_FILE)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration and exit")
+	for _, s := range settings {
+		s := s
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		record := func(v string) error {
+			flags = append(flags, flagValue{s, v})
+			return nil
+		}
+		if _, ok := s.value.(*boolValue); ok {
+			fs.BoolFunc(s.flag, usage, record)
+		} else {
+			fs.Func(s.flag, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+	if fs.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path, settings); err != nil {
+			return nil, false, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				return nil, false, fmt.Errorf("invalid %s %q: %v", s.env, v, err)
+			}
+		}
+	}
+	for _, f := range flags {
+		if err := f.s.value.Set(f.value); err != nil {
+			return nil, false, fmt.Errorf("invalid -%s %q: %v", f.s.flag, f.value, err)
+		}
+	}
+	return cfg, printConfig, cfg.validate()
+}
+
+// loadFile applies a config file.
+func (c *Config) loadFile(path string, settings []setting) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	values, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	for _, v := range values {
+		s, ok := byKey[v.key]
+		if !ok {
+			return fmt.Errorf("%s line %d: unknown setting %q", path, v.line, v.key)
+		}
+		if err := s.value.Set(v.value); err != nil {
+			return fmt.Errorf("%s line %d: invalid %s: %v", path, v.line, v.key, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the settings against each other and their allowed
+// ranges, reporting every problem at once.
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(validPort(c.Port), "port must be a number from 1 to 65535, got %q", c.Port)
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls cert_file and key_file must be set together")
+	if c.HTTPPort != "" {
+		check(c.TLSCertFile != "", "tls http_port needs cert_file and key_file")
+		check(validPort(c.HTTPPort) && c.HTTPPort != c.Port, "tls http_port must be a port number other than port, got %q", c.HTTPPort)
+	}
+	check(c.HSTSMaxAge >= 0, "hsts max age must not be negative")
+	for name, d := range map[string]time.Duration{
+		"read_header_timeout": c.HTTP.ReadHeaderTimeout,
+		"read_timeout":        c.HTTP.ReadTimeout,
+		"write_timeout":       c.HTTP.WriteTimeout,
+		"idle_timeout":        c.HTTP.IdleTimeout,
+		"shutdown_timeout":    c.HTTP.ShutdownTimeout,
+		"snapshot_interval":   c.SnapshotInterval,
+	} {
+		check(d > 0, "%s must be positive", name)
+	}
+	check(c.HTTP.MaxHeaderBytes > 0, "max_header_bytes must be positive")
+	check(c.RateLimit >= 0, "rate_limit must not be negative")
+	if _, err := parseDomains(strings.Join(c.Domains, ",")); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFallback(c.Fallback); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	for name, level := range map[string]string{"log level": c.LogLevel, "audit log level": c.AuditLogLevel} {
+		var l slog.Level
+		check(l.UnmarshalText([]byte(level)) == nil, "invalid %s %q", name, level)
+	}
+	if c.ErrorPages != "" {
+		info, err := os.Stat(c.ErrorPages)
+		check(err == nil && info.IsDir(), "error_pages %q is not a directory", c.ErrorPages)
+	}
+	if c.TemplatesDir != "" {
+		info, err := os.Stat(c.TemplatesDir)
+		check(err == nil && info.IsDir(), "templates dir %q is not a directory", c.TemplatesDir)
+	}
+	if err := c.Branding.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.MetadataWorkers >= 0, "metadata workers must not be negative")
+	check(c.LinkCheckInterval >= 0, "link check interval must not be negative")
+	check(c.LinkCheckFailures >= 1, "link check failures must be at least 1")
+	check(c.NotifySpikeFactor >= 0, "spike factor must not be negative")
+	check(c.SMTP.Addr == "" || (c.SMTP.From != "" && len(c.SMTP.To) > 0), "smtp needs from and to when addr is set")
+	return errors.Join(errs...)
+}
+
+func validPort(s string) bool {
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port < 1<<16
+}
+
+// WriteTOML writes the configuration as a config file, with secrets
+// masked.
+func (c *Config) WriteTOML(w io.Writer) {
+	section := ""
+	for _, s := range c.settings() {
+		sec, name, _ := strings.Cut(s.key, ".")
+		if sec != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%s]\n", sec)
+			section = sec
+		}
+		value := s.value.toml()
+		if s.secret && s.value.String() != "" {
+			value = `"********"`
+		}
+		fmt.Fprintf(w, "%s = %s\n", name, value)
+	}
+}
+
+// configEntry is a key and value read from a config file.
+type configEntry struct {
+	key   string // section.name
+	value string // arrays are joined with commas
+	line  int
+}
+
+// parseConfigFile reads the subset of TOML used for configuration:
+// [section] headers and key = value pairs, where values are strings,
+// numbers, booleans or single-line arrays of those. # starts a comment.
+func parseConfigFile(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: invalid section header", line)
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		key, raw, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		entries = append(entries, configEntry{key: key, value: value, line: line})
+	}
+	return entries, scanner.Err()
+}
+
+// parseConfigValue turns a TOML value into the text form settings accept.
+func parseConfigValue(raw string) (string, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return "", errors.New("unterminated array")
+		}
+		var items []string
+		for _, item := range splitArray(raw[1 : len(raw)-1]) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	}
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return v, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "":
+		return "", errors.New("missing value")
+	}
+	return raw, nil
+}
+
+// stripComment removes a # comment that is not inside a string.
+func stripComment(s string) string {
+	var quote rune
+	escaped := false
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitArray splits array items on commas outside strings.
+func splitArray(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// Setting value types.
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) toml() string       { return strconv.Quote(string(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	*v = boolValue(b)
+	return err
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) toml() string   { return v.String() }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	*v = intValue(n)
+	return err
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) toml() string   { return v.String() }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	*v = floatValue(f)
+	return err
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+func (v *floatValue) toml() string   { return v.String() }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	*v = durationValue(d)
+	return err
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+func (v *durationValue) toml() string   { return strconv.Quote(v.String()) }
+
+// listValue is a comma-separated list.
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+func (v *listValue) toml() string {
+	quoted := make([]string, len(*v))
+	for i, item := range *v {
+		quoted[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+type milestonesValue []uint64
+
+func (v *milestonesValue) Set(s string) error {
+	m, err := parseMilestones(s)
+	*v = m
+	return err
+}
+func (v *milestonesValue) String() string {
+	items := make([]string, len(*v))
+	for i, m := range *v {
+		items[i] = strconv.FormatUint(m, 10)
+	}
+	return strings.Join(items, ",")
+}
+func (v *milestonesValue) toml() string { return "[" + strings.ReplaceAll(v.String(), ",", ", ") + "]" }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Domain is a branded short domain with its own namespace of codes.
+type Domain struct {
+	Host string `json:"host"`
+	// BaseURL prefixes the short URLs issued on this domain. It defaults to
+	// https:// followed by the host.
+	BaseURL string `json:"base_url,omitempty"`
+	// RootRedirect, if set, is where visitors to "/" on this domain are sent
+	// instead of the home page.
+	RootRedirect string `json:"root_redirect,omitempty"`
+	// Fallback is where visitors of unknown, expired, disabled or broken
+	// links on this domain are sent, unless the link has its own.
+	Fallback string `json:"fallback_url,omitempty"`
+	// Branding overrides the instance's branding on this domain's pages.
+	Branding *Branding `json:"branding,omitempty"`
+	// FallbackHits counts unknown codes sent to Fallback.
+	FallbackHits uint64 `json:"fallback_hits"`
+}
+
+// linkKey identifies a link. Domain is the registered host the link lives
+// on, or "" for the default domain.
+type linkKey struct {
+	Domain string
+	Code   string
+}
+
+// normalizeHost lower-cases a host and strips any port.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// namespace maps a request host to the link namespace it serves: the host
+// itself if it is a registered domain, otherwise the default "". The caller
+// must hold us.mu.
+func (us *URLShortener) namespace(host string) string {
+	host = normalizeHost(host)
+	if _, ok := us.domains[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// requestNamespace returns the namespace a request refers to. Pages on one
+// domain can address links on another with the domain query parameter.
+func (us *URLShortener) requestNamespace(r *http.Request) string {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	if d := r.URL.Query().Get("domain"); d != "" {
+		return us.namespace(d)
+	}
+	return us.namespace(r.Host)
+}
+
+// validate normalizes a domain and checks its URLs.
+func (d *Domain) validate() error {
+	d.Host = normalizeHost(d.Host)
+	if d.Host == "" || strings.ContainsAny(d.Host, "/ ") {
+		return errors.New("a valid host is required")
+	}
+	d.BaseURL = strings.TrimSuffix(d.BaseURL, "/")
+	if d.BaseURL != "" {
+		if u, err := url.Parse(d.BaseURL); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid base_url %q", d.BaseURL)
+		}
+	}
+	if d.RootRedirect != "" {
+		if u, err := url.Parse(d.RootRedirect); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid root_redirect %q", d.RootRedirect)
+		}
+	}
+	if d.Branding != nil {
+		if err := d.Branding.validate(); err != nil {
+			return err
+		}
+	}
+	return validateFallback(d.Fallback)
+}
+
+// baseURL returns the prefix for short URLs on the domain.
+func (d *Domain) baseURL() string {
+	if d.BaseURL != "" {
+		return d.BaseURL
+	}
+	return "https://" + d.Host
+}
+
+// parseDomains reads the DOMAINS setting: a comma-separated list of hosts,
+// each optionally followed by "=" and the URL its root redirects to.
+func parseDomains(s string) ([]Domain, error) {
+	var domains []Domain
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, root, _ := strings.Cut(entry, "=")
+		d := Domain{Host: host, RootRedirect: root}
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("domain %q: %v", entry, err)
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+// AddDomain registers or replaces a domain and returns it as stored, with
+// its host and URLs normalized.
+func (us *URLShortener) AddDomain(d Domain) (Domain, error) {
+	if err := d.validate(); err != nil {
+		return Domain{}, err
+	}
+	us.mu.Lock()
+	d.FallbackHits = 0
+	if prev, ok := us.domains[d.Host]; ok {
+		d.FallbackHits = prev.FallbackHits
+	}
+	stored := d
+	us.domains[d.Host] = &stored
+	us.mu.Unlock()
+	return d, nil
+}
+
+// HandleDomains manages the domain registry:
+//
+//	GET    /admin/domains         list registered domains
+//	POST   /admin/domains         register or update a domain
+//	DELETE /admin/domains/{host}  remove a domain that has no links
+func (us *URLShortener) HandleDomains(w http.ResponseWriter, r *http.Request) {
+	if !us.requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		us.mu.RLock()
+		domains := make([]Domain, 0, len(us.domains))
+		for _, d := range us.domains {
+			domains = append(domains, *d)
+		}
+		us.mu.RUnlock()
+		sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(domains)
+
+	case http.MethodPost:
+		var d Domain
+		if !decodeJSON(w, r, &d) {
+			return
+		}
+		stored, err := us.AddDomain(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stored)
+
+	case http.MethodDelete:
+		host := normalizeHost(strings.TrimPrefix(r.URL.Path, "/admin/domains/"))
+		us.mu.Lock()
+		defer us.mu.Unlock()
+		if _, ok := us.domains[host]; !ok {
+			http.Error(w, "Domain not found", http.StatusNotFound)
+			return
+		}
+		for key := range us.store {
+			if key.Domain == host {
+				http.Error(w, "Domain still has links", http.StatusConflict)
+				return
+			}
+		}
+		delete(us.domains, host)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// exportVersion is the current version of the JSONL export format. Every
+// export starts with a header line, followed by one line per domain,
+// workspace, webhook and link. Version 1 exports have no workspace lines,
+// and versions before 3 no domain or webhook lines.
+const exportVersion = 3
+
+const maxImportBodyBytes = 256 << 20 // 256 MB
+
+// exportHeader is the first line of an export.
+type exportHeader struct {
+	Type       string    `json:"type"` // always "header"
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Domains    int       `json:"domains,omitempty"`
+	Workspaces int       `json:"workspaces"`
+	Webhooks   int       `json:"webhooks,omitempty"`
+	Links      int       `json:"links"`
+}
+
+// domainRecord is a registered domain with its branding and counters.
+type domainRecord struct {
+	Type string `json:"type"` // always "domain"
+	Domain
+}
+
+// workspaceRecord is a workspace with its members' key hashes.
+type workspaceRecord struct {
+	Type      string    `json:"type"` // always "workspace"
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []Member  `json:"members"`
+}
+
+// webhookRecord is a webhook subscription, secret included.
+type webhookRecord struct {
+	Type string `json:"type"` // always "webhook"
+	Webhook
+}
+
+// exportFile is the parsed content of an export.
+type exportFile struct {
+	Domains    []domainRecord
+	Workspaces []workspaceRecord
+	Webhooks   []webhookRecord
+	Links      []linkRecord
+	Lines      []int // line number of each link, for error reports
+	Errors     []importError
+}
+
+// linkRecord is a single link with its metadata and counters.
+type linkRecord struct {
+	Type         string            `json:"type"` // always "link"
+	Code         string            `json:"code"`
+	Domain       string            `json:"domain,omitempty"`
+	Workspace    string            `json:"workspace,omitempty"`
+	LongURL      string            `json:"long_url"`
+	Title        string            `json:"title,omitempty"`
+	Meta         *PageMeta         `json:"meta,omitempty"`
+	OpenGraph    *OpenGraph        `json:"og,omitempty"`
+	CreatedAt    time.Time         `json:"created_at,omitempty"`
+	Creator      *UserInfo         `json:"creator,omitempty"`
+	ViewCount    uint64            `json:"view_count"`
+	Disabled     bool              `json:"disabled,omitempty"`
+	Fallback     string            `json:"fallback_url,omitempty"`
+	Notify       *NotifyRule       `json:"notify,omitempty"`
+	FallbackHits uint64            `json:"fallback_hits,omitempty"`
+	UniqueViews  []string          `json:"unique_views,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Folder       string            `json:"folder,omitempty"`
+	Rules        []RedirectRule    `json:"rules,omitempty"`
+	RuleHits     map[string]uint64 `json:"rule_hits,omitempty"`
+	Variants     []Variant         `json:"variants,omitempty"`
+}
+
+// Import conflict policies for codes that already exist.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+// importReport summarizes what an import did, or would do in a dry run.
+type importReport struct {
+	DryRun      bool          `json:"dry_run"`
+	Domains     int           `json:"domains,omitempty"`
+	Workspaces  int           `json:"workspaces,omitempty"`
+	Webhooks    int           `json:"webhooks,omitempty"`
+	Imported    int           `json:"imported"`
+	Skipped     int           `json:"skipped"`
+	Overwritten int           `json:"overwritten"`
+	Renamed     []renamedCode `json:"renamed,omitempty"`
+	Errors      []importError `json:"errors,omitempty"`
+}
+
+type renamedCode struct {
+	Domain string `json:"domain,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// exportRecords snapshots every link in the store, ordered by code.
+func (us *URLShortener) exportRecords() []linkRecord {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	created := make(map[linkKey]URLCreation)
+	for _, urls := range us.userHistory {
+		for _, u := range urls {
+			created[linkKey{Domain: u.Domain, Code: u.ShortCode}] = u
+		}
+	}
+
+	records := make([]linkRecord, 0, len(us.store))
+	for key, data := range us.store {
+		rec := linkRecord{
+			Type:         "link",
+			Code:         key.Code,
+			Domain:       key.Domain,
+			LongURL:      data.LongURL,
+			Title:        data.Title,
+			Meta:         data.Meta,
+			OpenGraph:    data.OpenGraph,
+			ViewCount:    data.ViewCount,
+			Disabled:     data.Disabled,
+			Fallback:     data.Fallback,
+			Notify:       data.Notify,
+			FallbackHits: data.FallbackHits,
+			Tags:         data.Tags,
+			Folder:       data.Folder,
+			Workspace:    data.Workspace,
+			Rules:        data.Rules,
+			Variants:     data.Variants,
+		}
+		if c, ok := created[key]; ok {
+			info := c.UserInfo
+			rec.CreatedAt = c.CreatedAt
+			rec.Creator = &info
+		}
+		for ip := range data.UniqueViews {
+			rec.UniqueViews = append(rec.UniqueViews, ip)
+		}
+		sort.Strings(rec.UniqueViews)
+		if !data.ExpiresAt.IsZero() {
+			expires := data.ExpiresAt
+			rec.ExpiresAt = &expires
+		}
+		if len(data.RuleHits) > 0 {
+			rec.RuleHits = make(map[string]uint64, len(data.RuleHits))
+			for k, v := range data.RuleHits {
+				rec.RuleHits[k] = v
+			}
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Domain != records[j].Domain {
+			return records[i].Domain < records[j].Domain
+		}
+		return records[i].Code < records[j].Code
+	})
+	return records
+}
+
+// exportWorkspaces snapshots every workspace, ordered by ID.
+func (us *URLShortener) exportWorkspaces() []workspaceRecord {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	records := make([]workspaceRecord, 0, len(us.workspaces))
+	for _, ws := range us.workspaces {
+		rec := workspaceRecord{Type: "workspace", ID: ws.ID, Name: ws.Name, CreatedAt: ws.CreatedAt}
+		for _, m := range ws.Members {
+			rec.Members = append(rec.Members, *m)
+		}
+		sort.Slice(rec.Members, func(i, j int) bool { return rec.Members[i].Name < rec.Members[j].Name })
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+// exportDomains snapshots every registered domain, ordered by host.
+func (us *URLShortener) exportDomains() []domainRecord {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	records := make([]domainRecord, 0, len(us.domains))
+	for _, d := range us.domains {
+		records = append(records, domainRecord{Type: "domain", Domain: *d})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Host < records[j].Host })
+	return records
+}
+
+// exportWebhooks snapshots every webhook with its secret, oldest first.
+func (us *URLShortener) exportWebhooks() []webhookRecord {
+	d := us.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records := make([]webhookRecord, 0, len(d.hooks))
+	for _, h := range d.hooks {
+		records = append(records, webhookRecord{Type: "webhook", Webhook: *h})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	return records
+}
+
+// writeExport writes the header and records as JSONL.
+func writeExport(w io.Writer, file *exportFile) error {
+	enc := json.NewEncoder(w)
+	header := exportHeader{
+		Type:       "header",
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		Domains:    len(file.Domains),
+		Workspaces: len(file.Workspaces),
+		Webhooks:   len(file.Webhooks),
+		Links:      len(file.Links),
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, rec := range file.Domains {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	for _, rec := range file.Workspaces {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	for _, rec := range file.Webhooks {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	for _, rec := range file.Links {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readExport parses a JSONL export. Lines that cannot be parsed are
+// reported as errors rather than aborting the whole read.
+func readExport(r io.Reader) (*exportFile, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	file := &exportFile{}
+	sawHeader := false
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		var kind struct {
+			Type    string `json:"type"`
+			Version int    `json:"version"`
+		}
+		if err := json.Unmarshal(raw, &kind); err != nil {
+			file.Errors = append(file.Errors, importError{Line: line, Error: "invalid JSON"})
+			continue
+		}
+		switch kind.Type {
+		case "header":
+			if kind.Version < 1 || kind.Version > exportVersion {
+				return nil, fmt.Errorf("unsupported export version %d", kind.Version)
+			}
+			sawHeader = true
+		case "domain":
+			var rec domainRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				file.Errors = append(file.Errors, importError{Line: line, Error: "invalid domain record"})
+				continue
+			}
+			if err := rec.validate(); err != nil {
+				file.Errors = append(file.Errors, importError{Line: line, Error: err.Error()})
+				continue
+			}
+			file.Domains = append(file.Domains, rec)
+		case "workspace":
+			var rec workspaceRecord
+			if err := json.Unmarshal(raw, &rec); err != nil || rec.ID == "" {
+				file.Errors = append(file.Errors, importError{Line: line, Error: "invalid workspace record"})
+				continue
+			}
+			file.Workspaces = append(file.Workspaces, rec)
+		case "webhook":
+			var rec webhookRecord
+			if err := json.Unmarshal(raw, &rec); err != nil || rec.ID == "" || rec.Secret == "" {
+				file.Errors = append(file.Errors, importError{Line: line, Error: "invalid webhook record"})
+				continue
+			}
+			if err := rec.validate(); err != nil {
+				file.Errors = append(file.Errors, importError{Line: line, Error: err.Error()})
+				continue
+			}
+			file.Webhooks = append(file.Webhooks, rec)
+		case "link":
+			var rec linkRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				file.Errors = append(file.Errors, importError{Line: line, Error: err.Error()})
+				continue
+			}
+			file.Links = append(file.Links, rec)
+			file.Lines = append(file.Lines, line)
+		default:
+			file.Errors = append(file.Errors, importError{Line: line, Error: fmt.Sprintf("unknown record type %q", kind.Type)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawHeader {
+		return nil, errors.New("missing export header")
+	}
+	return file, nil
+}
+
+// importDomains registers domains that do not exist yet; with overwrite set
+// existing ones are replaced. It returns the number of domains imported.
+func (us *URLShortener) importDomains(records []domainRecord, overwrite, dryRun bool) int {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	imported := 0
+	for _, rec := range records {
+		if _, exists := us.domains[rec.Host]; exists && !overwrite {
+			continue
+		}
+		imported++
+		if !dryRun {
+			d := rec.Domain
+			us.domains[d.Host] = &d
+		}
+	}
+	return imported
+}
+
+// importWebhooks adds webhooks that do not exist yet; with overwrite set
+// existing ones are replaced. It returns the number of webhooks imported.
+func (us *URLShortener) importWebhooks(records []webhookRecord, overwrite, dryRun bool) int {
+	d := us.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	imported := 0
+	for _, rec := range records {
+		if _, exists := d.hooks[rec.ID]; exists && !overwrite {
+			continue
+		}
+		imported++
+		if !dryRun {
+			hook := rec.Webhook
+			d.hooks[hook.ID] = &hook
+		}
+	}
+	return imported
+}
+
+// importWorkspaces adds workspaces that do not exist yet; with overwrite set
+// existing ones are replaced. It returns the number of workspaces imported.
+func (us *URLShortener) importWorkspaces(records []workspaceRecord, overwrite, dryRun bool) int {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	imported := 0
+	for _, rec := range records {
+		if old, exists := us.workspaces[rec.ID]; exists {
+			if !overwrite {
+				continue
+			}
+			if !dryRun {
+				for _, m := range old.Members {
+					delete(us.memberKeys, m.KeyHash)
+				}
+			}
+		}
+		imported++
+		if dryRun {
+			continue
+		}
+		ws := &Workspace{ID: rec.ID, Name: rec.Name, CreatedAt: rec.CreatedAt, Members: make(map[string]*Member)}
+		for _, m := range rec.Members {
+			m := m
+			ws.Members[m.Name] = &m
+			us.memberKeys[m.KeyHash] = memberRef{Workspace: ws.ID, Name: m.Name}
+		}
+		us.workspaces[ws.ID] = ws
+	}
+	return imported
+}
+
+// toURLData rebuilds the stored form of a link record.
+func (rec linkRecord) toURLData() *URLData {
+	data := &URLData{
+		LongURL:      rec.LongURL,
+		Title:        rec.Title,
+		Meta:         rec.Meta,
+		OpenGraph:    rec.OpenGraph,
+		ViewCount:    rec.ViewCount,
+		Disabled:     rec.Disabled,
+		Fallback:     rec.Fallback,
+		Notify:       rec.Notify,
+		FallbackHits: rec.FallbackHits,
+		UniqueViews:  make(map[string]bool, len(rec.UniqueViews)),
+		Rules:        rec.Rules,
+		RuleHits:     make(map[string]uint64, len(rec.RuleHits)),
+		Variants:     rec.Variants,
+		Tags:         normalizeTags(rec.Tags),
+		Folder:       rec.Folder,
+		Workspace:    rec.Workspace,
+	}
+	for _, ip := range rec.UniqueViews {
+		data.UniqueViews[ip] = true
+	}
+	for k, v := range rec.RuleHits {
+		data.RuleHits[k] = v
+	}
+	if rec.ExpiresAt != nil {
+		data.ExpiresAt = *rec.ExpiresAt
+	}
+	return data
+}
+
+// validate checks a record the same way a new link would be checked, minus
+// the expiry which may legitimately be in the past.
+func (rec linkRecord) validate() error {
+	if rec.LongURL == "" {
+		return errors.New("long_url is required")
+	}
+	if err := validateRules(rec.Rules); err != nil {
+		return err
+	}
+	if rec.OpenGraph != nil {
+		if err := rec.OpenGraph.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateFallback(rec.Fallback); err != nil {
+		return err
+	}
+	if rec.Notify != nil {
+		if err := rec.Notify.validate(); err != nil {
+			return err
+		}
+	}
+	return validateVariants(rec.Variants)
+}
+
+// importOptions controls how importRecords treats incoming codes.
+type importOptions struct {
+	Conflict string // conflictSkip, conflictOverwrite or conflictRename
+	DryRun   bool
+	// Domain, if set, places every record on that domain instead of the
+	// one stored in the record.
+	Domain string
+	// CheckCode rejects codes that cannot be kept as they are, which are
+	// then reassigned. It defaults to validateAlias.
+	CheckCode func(string) error
+	// NewDomains are hosts registered by the same import, which a dry run
+	// has not added to the registry.
+	NewDomains []domainRecord
+}
+
+// importRecords adds records to the store according to the conflict policy.
+// Records on a domain that is not registered are reported as errors. With
+// DryRun set the store is left untouched and the report describes what
+// would have happened.
+func (us *URLShortener) importRecords(records []linkRecord, lines []int, opts importOptions) importReport {
+	report := importReport{DryRun: opts.DryRun}
+	dryRun := opts.DryRun
+	checkCode := opts.CheckCode
+	if checkCode == nil {
+		checkCode = validateAlias
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	// Codes claimed earlier in this import, so dry runs detect duplicates too.
+	claimed := make(map[linkKey]bool)
+	registered := func(domain string) bool {
+		if _, ok := us.domains[domain]; ok || domain == "" {
+			return true
+		}
+		for _, d := range opts.NewDomains {
+			if d.Host == domain {
+				return true
+			}
+		}
+		return false
+	}
+	taken := func(key linkKey) bool {
+		_, exists := us.store[key]
+		return exists || claimed[key]
+	}
+
+	for i, rec := range records {
+		if err := rec.validate(); err != nil {
+			report.Errors = append(report.Errors, importError{Line: lines[i], Error: err.Error()})
+			continue
+		}
+		domain := rec.Domain
+		if opts.Domain != "" {
+			domain = opts.Domain
+		}
+		key := linkKey{Domain: normalizeHost(domain), Code: rec.Code}
+		if !registered(key.Domain) {
+			report.Errors = append(report.Errors, importError{Line: lines[i], Error: fmt.Sprintf("domain %q is not registered", key.Domain)})
+			continue
+		}
+		var reason string
+		if key.Code == "" {
+			reason = "missing code"
+		} else if err := checkCode(key.Code); err != nil {
+			reason = err.Error()
+		} else if taken(key) {
+			switch opts.Conflict {
+			case conflictSkip:
+				report.Skipped++
+				continue
+			case conflictOverwrite:
+				if claimed[key] {
+					reason = "code repeated in import"
+				} else {
+					report.Overwritten++
+					if !dryRun {
+						us.removeLink(key)
+					}
+				}
+			default:
+				reason = "code already taken"
+			}
+		}
+		if reason != "" {
+			for {
+				key.Code = us.generateShortCode()
+				if !taken(key) {
+					break
+				}
+			}
+			report.Renamed = append(report.Renamed, renamedCode{Domain: key.Domain, From: rec.Code, To: key.Code, Reason: reason})
+		}
+		claimed[key] = true
+		report.Imported++
+		if dryRun {
+			continue
+		}
+
+		userInfo := UserInfo{CreatedAt: rec.CreatedAt}
+		if rec.Creator != nil {
+			userInfo = *rec.Creator
+		}
+		if userInfo.CreatedAt.IsZero() {
+			userInfo.CreatedAt = time.Now()
+		}
+		us.insertLink(key, rec.toURLData(), userInfo)
+	}
+	return report
+}
+
+// removeLink deletes a link from the store and from whichever history bucket
+// holds it. The caller must hold us.mu.
+func (us *URLShortener) removeLink(key linkKey) {
+	delete(us.store, key)
+	delete(us.clickRates, key)
+	us.index.remove(key)
+	for ip, urls := range us.userHistory {
+		filtered := urls[:0]
+		for _, u := range urls {
+			if u.ShortCode != key.Code || u.Domain != key.Domain {
+				filtered = append(filtered, u)
+			}
+		}
+		us.userHistory[ip] = filtered
+	}
+}
+
+// HandleExport streams every domain, workspace, webhook and link as
+// versioned JSONL. Webhooks carry their signing secrets, so the file is as
+// sensitive as the admin token.
+func (us *URLShortener) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !us.requireAdmin(w, r) {
+		return
+	}
+
+	file := &exportFile{Domains: us.exportDomains(), Workspaces: us.exportWorkspaces(), Webhooks: us.exportWebhooks(), Links: us.exportRecords()}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links-%s.jsonl"`, time.Now().UTC().Format("20060102-150405")))
+	writeExport(w, file)
+}
+
+// HandleImport loads a JSONL export. The conflict query parameter picks what
+// happens to codes that already exist (skip, overwrite or rename, default
+// skip) and dry_run=true reports the outcome without changing anything.
+func (us *URLShortener) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !us.requireAdmin(w, r) {
+		return
+	}
+
+	conflict := r.URL.Query().Get("conflict")
+	switch conflict {
+	case "":
+		conflict = conflictSkip
+	case conflictSkip, conflictOverwrite, conflictRename:
+	default:
+		http.Error(w, "conflict must be skip, overwrite or rename", http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	file, err := readExport(http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	overwrite := conflict == conflictOverwrite
+	domains := us.importDomains(file.Domains, overwrite, dryRun)
+	workspaces := us.importWorkspaces(file.Workspaces, overwrite, dryRun)
+	webhooks := us.importWebhooks(file.Webhooks, overwrite, dryRun)
+	report := us.importRecords(file.Links, file.Lines, importOptions{Conflict: conflict, DryRun: dryRun, NewDomains: file.Domains})
+	report.Domains, report.Workspaces, report.Webhooks = domains, workspaces, webhooks
+	report.Errors = append(file.Errors, report.Errors...)
+	us.auditImport(r, "export", report)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
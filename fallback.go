@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// ErrorPage is the data for the branded 404 and 410 pages. Title and
+// Message are given in English and translated into the visitor's language.
+type ErrorPage struct {
+	Status  int
+	Title   string
+	Message string
+	Host    string
+	Brand   Branding
+	Locale  *Locale
+}
+
+// validateFallback checks a fallback URL.
+func validateFallback(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid fallback_url %q", s)
+	}
+	return nil
+}
+
+// fallbackFor returns where to send visitors of a link that cannot be
+// served: the link's own fallback, else its domain's. data may be nil for
+// unknown codes. The caller must hold us.mu.
+func (us *URLShortener) fallbackFor(domain string, data *URLData) string {
+	if data != nil && data.Fallback != "" {
+		return data.Fallback
+	}
+	if d, ok := us.domains[domain]; ok {
+		return d.Fallback
+	}
+	if domain == "" {
+		return us.fallback
+	}
+	return ""
+}
+
+// recordFallback counts a visitor sent to a fallback: on the link if there
+// is one, otherwise on its domain. The caller must hold us.mu for writing.
+func (us *URLShortener) recordFallback(domain string, data *URLData) {
+	switch d, ok := us.domains[domain]; {
+	case data != nil:
+		data.FallbackHits++
+	case ok:
+		d.FallbackHits++
+	default:
+		us.fallbackHits++
+	}
+}
+
+// LoadErrorPages replaces the built-in 404 and 410 pages with 404.html and
+// 410.html from dir, where present. Both are html/template files executed
+// with an ErrorPage.
+func (us *URLShortener) LoadErrorPages(dir string) error {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.html", status))
+		tmpl, err := template.ParseFiles(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		us.errorPages[status] = tmpl
+	}
+	return nil
+}
+
+// serveErrorPage writes the branded page for a link that cannot be served.
+func (us *URLShortener) serveErrorPage(w http.ResponseWriter, r *http.Request, page ErrorPage) {
+	page.Host = r.Host
+	page.Brand = us.requestBranding(r)
+	page.Locale = localeFor(w, r)
+	page.Title, page.Message = page.Locale.T(page.Title), page.Locale.T(page.Message)
+	tmpl, ok := us.errorPages[page.Status]
+	if !ok {
+		tmpl = us.template("error.html")
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, page); err != nil {
+		slog.Error("Template execution failed", "template", "error", "err", err)
+		http.Error(w, page.Message, page.Status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(page.Status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// geoDB maps IP addresses to ISO country codes using a local CSV database.
+// Each row is either "cidr,country" or "first_ip,last_ip,country", which
+// covers the free DB-IP and IP2Location LITE country exports.
+type geoDB struct {
+	ranges []geoRange
+}
+
+type geoRange struct {
+	first   netip.Addr
+	last    netip.Addr
+	country string
+}
+
+// loadGeoDB reads a country database from path.
+func loadGeoDB(path string) (*geoDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+
+	db := &geoDB{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rng, err := parseGeoRecord(record)
+		if err != nil {
+			// Tolerate a header row.
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].first.Less(db.ranges[j].first)
+	})
+	return db, nil
+}
+
+func parseGeoRecord(record []string) (geoRange, error) {
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(record[0])
+		if err != nil {
+			return geoRange{}, err
+		}
+		prefix = prefix.Masked()
+		return geoRange{
+			first:   prefix.Addr().Unmap(),
+			last:    lastAddr(prefix).Unmap(),
+			country: strings.ToUpper(record[1]),
+		}, nil
+	case 3:
+		first, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return geoRange{}, err
+		}
+		last, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return geoRange{}, err
+		}
+		return geoRange{first: first.Unmap(), last: last.Unmap(), country: strings.ToUpper(record[2])}, nil
+	}
+	return geoRange{}, errors.New("expected 2 or 3 columns")
+}
+
+// lastAddr returns the highest address in prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	for i := range b {
+		for bit := 0; bit < 8; bit++ {
+			if i*8+bit >= bits {
+				b[i] |= 0x80 >> bit
+			}
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Country returns the country code for ip, or "" when it is unknown.
+func (db *geoDB) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	// Find the last range starting at or before addr.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].first)
+	}) - 1
+	if i < 0 {
+		return ""
+	}
+	rng := db.ranges[i]
+	if rng.first.Is4() != addr.Is4() || rng.last.Less(addr) {
+		return ""
+	}
+	return rng.country
+}
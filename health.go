@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// version is the build version, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version string
+
+// buildVersion returns version, else the module version or VCS revision
+// recorded by the Go toolchain.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return "dev-" + s.Value[:12]
+		}
+	}
+	return "dev"
+}
+
+// Check statuses.
+const (
+	checkOK         = "ok"
+	checkDisabled   = "disabled"
+	checkBacklogged = "backlogged" // queue nearly full, new work may be dropped
+	checkStalled    = "stalled"
+	checkFailing    = "failing"
+)
+
+// componentStatus describes the storage backend or a background worker.
+type componentStatus struct {
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Queue    int        `json:"queue,omitempty"`
+	Capacity int        `json:"capacity,omitempty"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+}
+
+// healthReport is the body of /healthz and /readyz.
+type healthReport struct {
+	Status  string                     `json:"status"` // ok or unavailable
+	Version string                     `json:"version"`
+	Uptime  string                     `json:"uptime,omitempty"`
+	Storage *componentStatus           `json:"storage,omitempty"`
+	Workers map[string]componentStatus `json:"workers,omitempty"`
+}
+
+// queueStatus reports a worker queue as backlogged once it is 90% full.
+func queueStatus(length, capacity int) componentStatus {
+	s := componentStatus{Status: checkOK, Queue: length, Capacity: capacity}
+	if length*10 >= capacity*9 {
+		s.Status = checkBacklogged
+	}
+	return s
+}
+
+// storageStatus checks that DATA_FILE can still be written: its directory
+// exists and the latest save succeeded. Without DATA_FILE the store is
+// memory only and always available.
+func (us *URLShortener) storageStatus() componentStatus {
+	s := us.snapshot
+	if s == nil {
+		return componentStatus{Status: checkOK}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := componentStatus{Status: checkOK}
+	if !s.saved.IsZero() {
+		saved := s.saved
+		status.LastRun = &saved
+	}
+	if _, err := os.Stat(filepath.Dir(s.path)); err != nil {
+		status.Status, status.Error = checkFailing, err.Error()
+	} else if s.err != nil {
+		status.Status, status.Error = checkFailing, s.err.Error()
+	}
+	return status
+}
+
+// workerStatus reports on each background worker. The link checker counts
+// as stalled if it has not finished a round in two intervals.
+func (us *URLShortener) workerStatus() map[string]componentStatus {
+	workers := map[string]componentStatus{
+		"webhooks":      queueStatus(len(us.webhooks.queue), cap(us.webhooks.queue)),
+		"metadata":      {Status: checkDisabled},
+		"link_checker":  {Status: checkDisabled},
+		"notifications": {Status: checkDisabled},
+	}
+	if us.meta != nil {
+		workers["metadata"] = queueStatus(len(us.meta.jobs), cap(us.meta.jobs))
+	}
+	if us.notify != nil {
+		workers["notifications"] = queueStatus(len(us.notify.queue), cap(us.notify.queue))
+	}
+	if c := us.checker; c != nil {
+		s := componentStatus{Status: checkOK}
+		c.mu.Lock()
+		if !c.lastRun.IsZero() {
+			lastRun := c.lastRun
+			s.LastRun = &lastRun
+		}
+		c.mu.Unlock()
+		if time.Since(c.lastActive()) > 2*c.interval {
+			s.Status = checkStalled
+		}
+		workers["link_checker"] = s
+	}
+	return workers
+}
+
+// HandleHealthz is the liveness probe: it answers as long as the process
+// serves requests.
+func (us *URLShortener) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: checkOK, Version: buildVersion()}
+	if us.metrics != nil {
+		report.Uptime = time.Since(us.metrics.started).Round(time.Second).String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleReadyz is the readiness probe. It fails with 503 only when the
+// storage cannot be written. Backlogged or stalled workers are reported in
+// the body but do not take the instance out of rotation, since redirects
+// keep working without them.
+func (us *URLShortener) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	storage := us.storageStatus()
+	report := healthReport{
+		Status:  checkOK,
+		Version: buildVersion(),
+		Storage: &storage,
+		Workers: us.workerStatus(),
+	}
+	status := http.StatusOK
+	if storage.Status == checkFailing {
+		report.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// localeCookie remembers the language a visitor picked.
+const localeCookie = "lang"
+
+// Locale translates the web UI into one language. Messages are keyed by
+// their English text, so anything missing from a catalog is shown in
+// English.
+type Locale struct {
+	Tag            string            `json:"-"`
+	Name           string            `json:"name"` // in the language itself, for the language picker
+	DateFormat     string            `json:"date_format"`
+	DateTimeFormat string            `json:"datetime_format"`
+	Months         []string          `json:"months,omitempty"` // abbreviations that replace "Jan" in the formats
+	Messages       map[string]string `json:"messages"`
+
+	parent *Locale // the base language of a regional catalog such as pt-br
+}
+
+// locales are the catalogs in assets/locales, by lower-case tag.
+var locales = loadLocales()
+
+// defaultLocale is used when a visitor accepts none of the locales.
+var defaultLocale = locales["en"]
+
+func loadLocales() map[string]*Locale {
+	catalogs := make(map[string]*Locale)
+	paths, _ := fs.Glob(assets, "assets/locales/*.json")
+	for _, p := range paths {
+		body, err := assets.ReadFile(p)
+		if err != nil {
+			panic(err)
+		}
+		l := &Locale{Tag: strings.ToLower(strings.TrimSuffix(path.Base(p), ".json"))}
+		if err := json.Unmarshal(body, l); err != nil {
+			panic(fmt.Sprintf("locale %s: %v", p, err))
+		}
+		if l.Months != nil && len(l.Months) != 12 {
+			panic(fmt.Sprintf("locale %s: months must have 12 entries", p))
+		}
+		catalogs[l.Tag] = l
+	}
+	for tag, l := range catalogs {
+		if base, _, regional := strings.Cut(tag, "-"); regional {
+			l.parent = catalogs[base]
+		}
+		if p := l.parent; p != nil && l.DateFormat == "" {
+			l.DateFormat, l.DateTimeFormat, l.Months = p.DateFormat, p.DateTimeFormat, p.Months
+		}
+	}
+	return catalogs
+}
+
+// availableLocales lists the locales by tag, for the language picker.
+func availableLocales() []*Locale {
+	list := make([]*Locale, 0, len(locales))
+	for _, l := range locales {
+		list = append(list, l)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tag < list[j].Tag })
+	return list
+}
+
+// findLocale returns the catalog for a language tag, or for its base
+// language if there is none for the region. It returns nil if neither
+// exists.
+func findLocale(tag string) *Locale {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	return locales[base]
+}
+
+// localeFor picks the language of a page: the one named by a lang query
+// parameter, which is remembered in a cookie, else the cookie's, else the
+// best match for Accept-Language. It must be called before the response
+// is written.
+func localeFor(w http.ResponseWriter, r *http.Request) *Locale {
+	w.Header().Add("Vary", "Accept-Language")
+	if l := findLocale(r.URL.Query().Get("lang")); l != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     localeCookie,
+			Value:    l.Tag,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return l
+	}
+	if cookie, err := r.Cookie(localeCookie); err == nil {
+		if l := findLocale(cookie.Value); l != nil {
+			return l
+		}
+	}
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if l := findLocale(tag); l != nil {
+			return l
+		}
+	}
+	return defaultLocale
+}
+
+// T translates msg, then formats it with args as fmt.Sprintf does if there
+// are any. A message missing from a regional catalog is looked up in its
+// base language, then left in English.
+func (l *Locale) T(msg string, args ...any) string {
+	s := msg
+	for c := l; c != nil; c = c.parent {
+		if t, ok := c.Messages[msg]; ok && t != "" {
+			s = t
+			break
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
+
+// N translates the singular or the plural form of a message for n, which
+// is also its argument.
+func (l *Locale) N(n any, singular, plural string) string {
+	msg := plural
+	switch n := n.(type) {
+	case int:
+		if n == 1 {
+			msg = singular
+		}
+	case uint64:
+		if n == 1 {
+			msg = singular
+		}
+	}
+	return l.T(msg, n)
+}
+
+// Date formats the date of t in the locale's style.
+func (l *Locale) Date(t time.Time) string {
+	return l.format(t, l.DateFormat)
+}
+
+// DateTime formats t to the minute in the locale's style.
+func (l *Locale) DateTime(t time.Time) string {
+	return l.format(t, l.DateTimeFormat)
+}
+
+// format is t.Format with the "Jan" element spelled in the locale's
+// language.
+func (l *Locale) format(t time.Time, layout string) string {
+	if l.Months == nil {
+		return t.Format(layout)
+	}
+	parts := strings.Split(layout, "Jan")
+	for i, part := range parts {
+		parts[i] = t.Format(part)
+	}
+	return strings.Join(parts, l.Months[t.Month()-1])
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocaleFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		accept string
+		want   string
+	}{
+		{name: "no preference", want: "en"},
+		{name: "accept-language", accept: "fr-FR,fr;q=0.9,en;q=0.8", want: "fr"},
+		{name: "quality order", accept: "de;q=0.5, es;q=0.8, en;q=0.3", want: "es"},
+		{name: "regional falls back to base", accept: "es-MX", want: "es"},
+		{name: "unsupported skipped", accept: "ja, fr;q=0.5", want: "fr"},
+		{name: "nothing supported", accept: "ja, zh-CN;q=0.8", want: "en"},
+		{name: "wildcard", accept: "*", want: "en"},
+		{name: "zero quality ignored", accept: "fr;q=0, es;q=0.1", want: "es"},
+		{name: "cookie beats header", cookie: "es", accept: "fr", want: "es"},
+		{name: "unknown cookie ignored", cookie: "xx", accept: "fr", want: "fr"},
+		{name: "query beats cookie", query: "fr", cookie: "es", want: "fr"},
+		{name: "unknown query ignored", query: "xx", cookie: "es", want: "es"},
+		{name: "query is case-insensitive", query: "FR", want: "fr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?lang="+tt.query, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: localeCookie, Value: tt.cookie})
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept-Language", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			if got := localeFor(w, r); got.Tag != tt.want {
+				t.Errorf("locale = %q, want %q", got.Tag, tt.want)
+			}
+			if vary := w.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Language" {
+				t.Errorf("Vary = %q, want Accept-Language", vary)
+			}
+		})
+	}
+}
+
+func TestLocaleForRemembersQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?lang=es", nil)
+	w := httptest.NewRecorder()
+	localeFor(w, r)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != localeCookie || cookies[0].Value != "es" {
+		t.Fatalf("cookies = %v, want %s=es", cookies, localeCookie)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	localeFor(w, r)
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("cookies = %v, want none without a lang parameter", cookies)
+	}
+}
+
+func TestLocaleFallsBackToEnglish(t *testing.T) {
+	fr := findLocale("fr")
+	if got := fr.T("URL Statistics"); got != "Statistiques de l’URL" {
+		t.Errorf("T(URL Statistics) = %q", got)
+	}
+	if got := fr.T("A message no catalog has"); got != "A message no catalog has" {
+		t.Errorf("missing message = %q, want the English text", got)
+	}
+	if got := fr.N(2, "%d view", "%d views"); got != "2 visites" {
+		t.Errorf("N(2) = %q, want 2 visites", got)
+	}
+
+	// A regional catalog without its own messages uses its base language.
+	regional := &Locale{Tag: "fr-ca", parent: fr}
+	if got := regional.T("URL Statistics"); got != "Statistiques de l’URL" {
+		t.Errorf("regional T = %q, want the fr translation", got)
+	}
+	if findLocale("fr-CA") != fr {
+		t.Errorf("findLocale(fr-CA) did not fall back to fr")
+	}
+	if findLocale("ja") != nil {
+		t.Errorf("findLocale(ja) = non-nil, want nil")
+	}
+}
+
+func TestLocaleDates(t *testing.T) {
+	when := time.Date(2024, time.August, 3, 14, 5, 0, 0, time.UTC)
+	tests := map[string]string{
+		"en": "Aug 03, 2024",
+		"es": "3 ago 2024",
+		"fr": "3 août 2024",
+	}
+	for tag, want := range tests {
+		if got := findLocale(tag).Date(when); got != want {
+			t.Errorf("%s: Date = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// Pages come out in the negotiated language, including the strings their
+// scripts read from data attributes.
+func TestPagesUseNegotiatedLocale(t *testing.T) {
+	us := NewURLShortener("http://localhost")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "es")
+	w := httptest.NewRecorder()
+	us.HandleRedirect(w, r)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `lang="es"`) {
+		t.Errorf("home page is not marked as Spanish")
+	}
+	if !strings.Contains(body, `data-shorten-error="Error al acortar la URL"`) {
+		t.Errorf("home page lacks the translated shorten error")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "ja")
+	w = httptest.NewRecorder()
+	us.HandleRedirect(w, r)
+	if !strings.Contains(w.Body.String(), `data-shorten-error="Error shortening URL"`) {
+		t.Errorf("unsupported language did not fall back to English")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// External export formats accepted by HandleExternalImport.
+const (
+	formatCSV        = "csv"
+	formatYOURLSSQL  = "yourls-sql"
+	yourlsTimeLayout = "2006-01-02 15:04:05"
+)
+
+// Header names other shorteners use for the short code and destination
+// columns of their CSV exports. YOURLS CSV exports use "keyword" and "url".
+var (
+	codeColumns = []string{"short code", "short_code", "shortcode", "code", "keyword", "slug", "alias", "back-half", "back_half", "short url", "short_url", "short link", "short_link"}
+	urlColumns  = []string{"long url", "long_url", "longurl", "url", "destination", "destination url", "target", "target url", "original url", "original_url"}
+)
+
+// HandleExternalImport recreates links from another shortener's export.
+// The format query parameter selects "csv" (default) for generic CSV exports
+// or "yourls-sql" for YOURLS database dumps. Original codes are kept when
+// they are valid base62 and free; the rest are reassigned and listed in the
+// report. The links are created on the default domain unless a registered
+// domain is given. dry_run=true reports the outcome without changing anything.
+func (us *URLShortener) HandleExternalImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !us.requireAdmin(w, r) {
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBodyBytes)
+	var records []linkRecord
+	var lines []int
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", formatCSV:
+		records, lines, err = parseExternalCSV(body)
+	case formatYOURLSSQL:
+		records, lines, err = parseYOURLSSQL(body)
+	default:
+		err = fmt.Errorf("unknown format %q, use %s or %s", format, formatCSV, formatYOURLSSQL)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domain := normalizeHost(r.URL.Query().Get("domain"))
+	if domain != "" {
+		us.mu.RLock()
+		_, ok := us.domains[domain]
+		us.mu.RUnlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("domain %q is not registered", domain), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := us.importRecords(records, lines, importOptions{
+		Conflict:  conflictRename,
+		DryRun:    r.URL.Query().Get("dry_run") == "true",
+		CheckCode: validateBase62Code,
+		Domain:    domain,
+	})
+	us.auditImport(r, "external", report)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// validateBase62Code accepts codes made only of base62 characters that are
+// not reserved application paths.
+func validateBase62Code(code string) error {
+	if len(code) > maxAliasLength {
+		return errors.New("code is too long")
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(base62Chars, c) {
+			return errors.New("code is not base62")
+		}
+	}
+	if reservedPaths[strings.ToLower(code)] {
+		return errors.New("code is reserved")
+	}
+	return nil
+}
+
+// parseExternalCSV reads a CSV export with a header row, finding the short
+// code and long URL columns by name. Optional "clicks" and "created" or
+// "timestamp" columns carry over the view count and creation time.
+func parseExternalCSV(r io.Reader) ([]linkRecord, []int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, errors.New("CSV must start with a header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		if _, dup := columns[name]; !dup {
+			columns[name] = i
+		}
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	codeCol, urlCol := find(codeColumns), find(urlColumns)
+	if codeCol < 0 || urlCol < 0 {
+		return nil, nil, errors.New("CSV header needs a short code column (e.g. \"keyword\") and a long URL column (e.g. \"url\")")
+	}
+	clicksCol := find([]string{"clicks", "click count", "total clicks", "visits"})
+	createdCol := find([]string{"created", "created_at", "created at", "date", "timestamp"})
+
+	var records []linkRecord
+	var lines []int
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		rec := linkRecord{
+			Type:    "link",
+			Code:    codeFromShortURL(field(codeCol)),
+			LongURL: field(urlCol),
+		}
+		rec.ViewCount, _ = strconv.ParseUint(field(clicksCol), 10, 64)
+		rec.CreatedAt = parseExternalTime(field(createdCol))
+		records = append(records, rec)
+		lines = append(lines, line)
+	}
+	return records, lines, nil
+}
+
+// codeFromShortURL accepts either a bare code or a full short link such as
+// "https://sho.rt/abc" and returns the code.
+func codeFromShortURL(s string) string {
+	if !strings.Contains(s, "/") {
+		return s
+	}
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = u.Path
+	}
+	return strings.Trim(s[strings.LastIndex(strings.TrimRight(s, "/"), "/")+1:], "/")
+}
+
+// parseExternalTime understands the timestamp formats common in exports.
+func parseExternalTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, yourlsTimeLayout, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0)
+	}
+	return time.Time{}
+}
+
+// yourlsColumns is the column order of the yourls_url table, used when an
+// INSERT statement does not list its columns.
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+// parseYOURLSSQL extracts links from the INSERT statements for the
+// yourls_url table in a mysqldump of a YOURLS database. Other statements and
+// tables are ignored.
+func parseYOURLSSQL(r io.Reader) ([]linkRecord, []int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+
+	var records []linkRecord
+	var lines []int
+	for line := 1; scanner.Scan(); line++ {
+		stmt := strings.TrimSpace(scanner.Text())
+		if !isYOURLSInsert(stmt) {
+			continue
+		}
+		rows, columns, err := parseInsert(stmt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if columns == nil {
+			columns = yourlsColumns
+		}
+		index := make(map[string]int)
+		for i, c := range columns {
+			index[c] = i
+		}
+		if _, ok := index["keyword"]; !ok {
+			continue
+		}
+		for _, row := range rows {
+			value := func(name string) string {
+				i, ok := index[name]
+				if !ok || i >= len(row) {
+					return ""
+				}
+				return row[i]
+			}
+			rec := linkRecord{
+				Type:      "link",
+				Code:      value("keyword"),
+				LongURL:   value("url"),
+				CreatedAt: parseExternalTime(value("timestamp")),
+			}
+			rec.ViewCount, _ = strconv.ParseUint(value("clicks"), 10, 64)
+			records = append(records, rec)
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("no yourls_url INSERT statements found")
+	}
+	return records, lines, nil
+}
+
+// isYOURLSInsert reports whether stmt inserts into the links table, which is
+// called yourls_url unless the installation uses a different table prefix.
+func isYOURLSInsert(stmt string) bool {
+	const prefix = "INSERT INTO "
+	if len(stmt) < len(prefix) || !strings.EqualFold(stmt[:len(prefix)], prefix) {
+		return false
+	}
+	table, _, _ := strings.Cut(strings.TrimSpace(stmt[len(prefix):]), " ")
+	table, _, _ = strings.Cut(table, "(")
+	table = strings.ToLower(strings.Trim(table, "`\""))
+	return table == "url" || strings.HasSuffix(table, "_url")
+}
+
+// parseInsert parses a single-line INSERT statement into its rows of values
+// and, if present, its column list. It understands the quoting and escaping
+// mysqldump produces.
+func parseInsert(stmt string) (rows [][]string, columns []string, err error) {
+	upper := strings.ToUpper(stmt)
+	values := strings.Index(upper, "VALUES")
+	if values < 0 {
+		return nil, nil, errors.New("INSERT without VALUES")
+	}
+	head := stmt[:values]
+	if open := strings.Index(head, "("); open >= 0 {
+		if end := strings.LastIndex(head, ")"); end > open {
+			for _, c := range strings.Split(head[open+1:end], ",") {
+				columns = append(columns, strings.ToLower(strings.Trim(strings.TrimSpace(c), "`\"")))
+			}
+		}
+	}
+
+	s := stmt[values+len("VALUES"):]
+	var row []string
+	var field strings.Builder
+	inRow, inString, quoted := false, false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString:
+			switch {
+			case c == '\\' && i+1 < len(s):
+				i++
+				field.WriteByte(unescapeSQL(s[i]))
+			case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+				i++
+				field.WriteByte('\'')
+			case c == '\'':
+				inString = false
+			default:
+				field.WriteByte(c)
+			}
+		case !inRow:
+			if c == '(' {
+				inRow = true
+				row = nil
+			}
+		case c == '\'':
+			inString, quoted = true, true
+		case c == ',' || c == ')':
+			value := field.String()
+			if !quoted {
+				value = strings.TrimSpace(value)
+				if strings.EqualFold(value, "NULL") {
+					value = ""
+				}
+			}
+			row = append(row, value)
+			field.Reset()
+			quoted = false
+			if c == ')' {
+				rows = append(rows, row)
+				inRow = false
+			}
+		case !quoted || !unicode.IsSpace(rune(c)):
+			field.WriteByte(c)
+		}
+	}
+	if inRow || inString {
+		return nil, nil, errors.New("unterminated VALUES list")
+	}
+	return rows, columns, nil
+}
+
+// unescapeSQL maps the character after a backslash in a MySQL string.
+func unescapeSQL(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case '0':
+		return 0
+	}
+	return c
+}
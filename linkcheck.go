@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	checkConcurrency = 4
+	defaultThreshold = 3
+)
+
+// LinkHealth is the outcome of the latest checks of a link's destination.
+type LinkHealth struct {
+	Status    int       `json:"status,omitempty"` // final HTTP status, 0 if the request failed
+	Error     string    `json:"error,omitempty"`
+	Chain     []string  `json:"chain,omitempty"` // redirects followed, in order
+	LatencyMS int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Failures  int       `json:"failures"` // consecutive failed checks
+	Broken    bool      `json:"broken"`
+	Unchecked bool      `json:"unchecked,omitempty"` // the checker may not reach the destination
+}
+
+// ok reports whether the check reached a page that is not an error.
+func (h *LinkHealth) ok() bool {
+	return h.Error == "" && h.Status > 0 && h.Status < 400
+}
+
+// linkChecker periodically checks every link's destination.
+type linkChecker struct {
+	client    *http.Client
+	interval  time.Duration
+	threshold int // consecutive failures before a link counts as broken
+
+	mu      sync.Mutex
+	started time.Time
+	lastRun time.Time // when the latest round finished
+}
+
+// lastActive returns when the checker last finished a round, or when it
+// started if it has not finished one yet.
+func (c *linkChecker) lastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastRun.IsZero() {
+		return c.started
+	}
+	return c.lastRun
+}
+
+// StartLinkChecker checks every destination once per interval and marks a
+// link broken after threshold consecutive failures.
+func (us *URLShortener) StartLinkChecker(interval time.Duration, threshold int, allowPrivate bool) {
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	c := &linkChecker{
+		client: &http.Client{
+			Transport: newSafeTransport(allowPrivate),
+			Timeout:   metaFetchTimeout,
+			// Redirects are followed by hand to record the chain.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		interval:  interval,
+		threshold: threshold,
+		started:   time.Now(),
+	}
+	us.checker = c
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			us.checkLinks(context.Background())
+		}
+	}()
+}
+
+// checkLinks runs one round of checks over every unexpired link.
+func (us *URLShortener) checkLinks(ctx context.Context) {
+	jobs := make(map[linkKey]string)
+	us.mu.RLock()
+	for key, data := range us.store {
+		if !data.expired() {
+			jobs[key] = data.LongURL
+		}
+	}
+	us.mu.RUnlock()
+
+	sem := make(chan struct{}, checkConcurrency)
+	var wg sync.WaitGroup
+	for key, longURL := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key linkKey, longURL string) {
+			defer func() { <-sem; wg.Done() }()
+			health := us.checker.check(ctx, longURL)
+			us.recordHealth(key, longURL, health)
+		}(key, longURL)
+	}
+	wg.Wait()
+	us.checker.mu.Lock()
+	us.checker.lastRun = time.Now()
+	us.checker.mu.Unlock()
+}
+
+// recordHealth stores a check result, carrying over the failure count.
+func (us *URLShortener) recordHealth(key linkKey, longURL string, health *LinkHealth) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	data, ok := us.store[key]
+	if !ok || data.LongURL != longURL {
+		return
+	}
+	// A destination the checker is not allowed to reach says nothing about
+	// whether it works, so it keeps its standing.
+	if health.Unchecked {
+		if data.Health != nil {
+			health.Failures, health.Broken = data.Health.Failures, data.Health.Broken
+		}
+		data.Health = health
+		return
+	}
+	if !health.ok() {
+		health.Failures = 1
+		if data.Health != nil {
+			health.Failures = data.Health.Failures + 1
+		}
+	}
+	health.Broken = health.Failures >= us.checker.threshold
+	if health.Broken && (data.Health == nil || !data.Health.Broken) {
+		slog.Warn("Link is broken", "short_url", us.shortURL(key), "reason", health.describe())
+	}
+	data.Health = health
+}
+
+// describe summarizes the outcome of a check.
+func (h *LinkHealth) describe() string {
+	if h.Error != "" {
+		return h.Error
+	}
+	return fmt.Sprintf("HTTP %d", h.Status)
+}
+
+// check requests a destination with HEAD, falling back to GET for servers
+// that reject or mishandle HEAD, and follows up to metaMaxRedirects
+// redirects.
+func (c *linkChecker) check(ctx context.Context, longURL string) *LinkHealth {
+	start := time.Now()
+	health := &LinkHealth{CheckedAt: start}
+	defer func() { health.LatencyMS = time.Since(start).Milliseconds() }()
+
+	target := longURL
+	for hops := 0; ; hops++ {
+		status, location, err := c.request(ctx, http.MethodHead, target)
+		if err != nil || status >= 400 {
+			status, location, err = c.request(ctx, http.MethodGet, target)
+		}
+		if err != nil {
+			health.Error = err.Error()
+			health.Unchecked = errors.Is(err, errPrivateAddress)
+			return health
+		}
+		health.Status = status
+		if status < 300 || status >= 400 || location == "" {
+			return health
+		}
+		if hops == metaMaxRedirects {
+			health.Error = fmt.Sprintf("more than %d redirects", metaMaxRedirects)
+			return health
+		}
+		base, _ := url.Parse(target)
+		next, err := base.Parse(location)
+		if err != nil {
+			health.Error = fmt.Sprintf("invalid redirect to %q", location)
+			return health
+		}
+		target = next.String()
+		health.Chain = append(health.Chain, target)
+	}
+}
+
+// request sends one request and returns its status and Location header.
+func (c *linkChecker) request(ctx context.Context, method, target string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", "url-shortner-linkcheck/1.0")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, resp.Header.Get("Location"), nil
+}
+
+// HandleBroken serves GET /api/broken: the broken links among those the
+// requester may list (see visibleLinks), with their latest check.
+func (us *URLShortener) HandleBroken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	us.mu.RLock()
+	urls, _, ok := us.visibleLinks(r, newLinkFilter(r))
+	if !ok {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	links := []linkSummary{}
+	for _, u := range urls {
+		key := linkKey{Domain: u.Domain, Code: u.ShortCode}
+		if data := us.store[key]; data.Health != nil && data.Health.Broken {
+			links = append(links, us.summarize(key, u, data))
+		}
+	}
+	us.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// checkTimes starts a checker that never ticks and runs n rounds by hand.
+func checkTimes(us *URLShortener, allowPrivate bool, n int) {
+	us.StartLinkChecker(time.Hour, 2, allowPrivate)
+	for i := 0; i < n; i++ {
+		us.checkLinks(context.Background())
+	}
+}
+
+func TestLinkCheckSkipsPrivateDestinations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	us := NewURLShortener("http://localhost")
+	key := linkKey{Code: "intranet"}
+	us.store[key] = &URLData{LongURL: srv.URL}
+	checkTimes(us, false, 3)
+
+	health := us.store[key].Health
+	if health == nil || !health.Unchecked {
+		t.Fatalf("health = %+v, want a not checked result", health)
+	}
+	if health.Failures != 0 || health.Broken {
+		t.Errorf("failures = %d, broken = %v; a refused check must not count", health.Failures, health.Broken)
+	}
+}
+
+func TestLinkCheckKeepsStandingWhenRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	us := NewURLShortener("http://localhost")
+	key := linkKey{Code: "moved"}
+	us.store[key] = &URLData{LongURL: srv.URL, Health: &LinkHealth{Failures: 1}}
+	checkTimes(us, false, 1)
+	if health := us.store[key].Health; health.Failures != 1 || health.Broken {
+		t.Errorf("failures = %d, broken = %v; want the earlier standing kept", health.Failures, health.Broken)
+	}
+}
+
+func TestLinkCheckAllowPrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	us := NewURLShortener("http://localhost")
+	up, gone := linkKey{Code: "up"}, linkKey{Code: "gone"}
+	us.store[up] = &URLData{LongURL: srv.URL + "/up"}
+	us.store[gone] = &URLData{LongURL: srv.URL + "/gone"}
+	checkTimes(us, true, 2)
+
+	if health := us.store[up].Health; health.Unchecked || health.Broken || health.Status != http.StatusOK {
+		t.Errorf("up: health = %+v, want a healthy check", health)
+	}
+	if health := us.store[gone].Health; !health.Broken || health.Failures != 2 {
+		t.Errorf("gone: health = %+v, want broken after 2 failures", health)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// linkSummary is the JSON form of a link in the list API.
+type linkSummary struct {
+	Code            string      `json:"code"`
+	Domain          string      `json:"domain,omitempty"`
+	ShortURL        string      `json:"short_url"`
+	LongURL         string      `json:"long_url"`
+	Title           string      `json:"title,omitempty"`
+	Meta            *PageMeta   `json:"meta,omitempty"`
+	OpenGraph       *OpenGraph  `json:"og,omitempty"`
+	Health          *LinkHealth `json:"health,omitempty"`
+	Disabled        bool        `json:"disabled,omitempty"`
+	Fallback        string      `json:"fallback_url,omitempty"`
+	FallbackHits    uint64      `json:"fallback_hits,omitempty"`
+	Notify          *NotifyRule `json:"notify,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	ExpiresAt       *time.Time  `json:"expires_at,omitempty"`
+	Workspace       string      `json:"workspace,omitempty"`
+	Folder          string      `json:"folder,omitempty"`
+	Tags            []string    `json:"tags,omitempty"`
+	ViewCount       uint64      `json:"view_count"`
+	UniqueViewCount int         `json:"unique_view_count"`
+}
+
+// linkUpdate is the body of an edit request. Fields left out are unchanged.
+type linkUpdate struct {
+	Title     *string     `json:"title,omitempty"`
+	OpenGraph *OpenGraph  `json:"og,omitempty"` // replaces all overrides; {} clears them
+	Disabled  *bool       `json:"disabled,omitempty"`
+	Fallback  *string     `json:"fallback_url,omitempty"`
+	Notify    *NotifyRule `json:"notify,omitempty"`
+	Tags      *[]string   `json:"tags,omitempty"`
+	Folder    *string     `json:"folder,omitempty"`
+}
+
+// tagStats aggregates the links carrying a tag.
+type tagStats struct {
+	Tag             string `json:"tag"`
+	Links           int    `json:"links"`
+	ViewCount       uint64 `json:"view_count"`
+	UniqueViewCount int    `json:"unique_view_count"`
+}
+
+// linkFilter narrows a list of links.
+type linkFilter struct {
+	Tag    string
+	Folder string
+}
+
+func newLinkFilter(r *http.Request) linkFilter {
+	q := r.URL.Query()
+	return linkFilter{
+		Tag:    strings.ToLower(strings.TrimSpace(q.Get("tag"))),
+		Folder: strings.TrimSpace(q.Get("folder")),
+	}
+}
+
+func (f linkFilter) matches(data *URLData) bool {
+	if f.Folder != "" && data.Folder != f.Folder {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range data.Tags {
+		if tag == f.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleLinks returns the links a request may list, oldest first: those of
+// the workspace named by ?workspace= if the requester is a member, otherwise
+// those created from the requester's IP, minus workspace links the requester
+// may not view, since an IP can be shared behind NAT or a proxy. Each entry
+// is filled in with the link's current counters, title, metadata, health,
+// tags and folder. ok is false if the requester is not allowed to see the
+// workspace. The caller must hold us.mu.
+func (us *URLShortener) visibleLinks(r *http.Request, filter linkFilter) (urls []URLCreation, workspace *Workspace, ok bool) {
+	if id := r.URL.Query().Get("workspace"); id != "" {
+		ws, exists := us.workspaces[id]
+		if !exists || (!us.hasRole(r, id, RoleViewer) && !us.isAdmin(r)) {
+			return nil, nil, false
+		}
+		workspace = ws
+		for _, created := range us.userHistory {
+			for _, u := range created {
+				if data, ok := us.store[linkKey{Domain: u.Domain, Code: u.ShortCode}]; ok && data.Workspace == id {
+					urls = append(urls, u)
+				}
+			}
+		}
+		sort.Slice(urls, func(i, j int) bool { return urls[i].CreatedAt.Before(urls[j].CreatedAt) })
+	} else {
+		urls = append(urls, us.userHistory[us.clientIP(r)]...)
+	}
+
+	filtered := urls[:0]
+	for _, u := range urls {
+		data, ok := us.store[linkKey{Domain: u.Domain, Code: u.ShortCode}]
+		if !ok || !filter.matches(data) || (workspace == nil && !us.canView(r, data)) {
+			continue
+		}
+		u.ViewCount = int(data.ViewCount)
+		u.UniqueViewCount = len(data.UniqueViews)
+		u.Title = data.displayTitle()
+		u.Meta = data.Meta
+		u.Health = data.Health
+		u.Disabled = data.Disabled
+		u.Tags = data.Tags
+		u.Folder = data.Folder
+		filtered = append(filtered, u)
+	}
+	return filtered, workspace, true
+}
+
+// HandleLinks serves the link API:
+//
+//	GET            /api/links              list links (?workspace=, ?tag=, ?folder=)
+//	POST or PATCH  /api/links/{code}       edit a link's title, og card, fallback,
+//	                                       disabled state, notify rule, tags or folder
+func (us *URLShortener) HandleLinks(w http.ResponseWriter, r *http.Request) {
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/links"), "/")
+	switch {
+	case code == "" && r.Method == http.MethodGet:
+		us.listLinks(w, r)
+	case code != "" && (r.Method == http.MethodPost || r.Method == http.MethodPatch):
+		us.editLink(w, r, code)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (us *URLShortener) listLinks(w http.ResponseWriter, r *http.Request) {
+	us.mu.RLock()
+	urls, _, ok := us.visibleLinks(r, newLinkFilter(r))
+	if !ok {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	links := make([]linkSummary, 0, len(urls))
+	for _, u := range urls {
+		key := linkKey{Domain: u.Domain, Code: u.ShortCode}
+		links = append(links, us.summarize(key, u, us.store[key]))
+	}
+	us.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// summarize builds the list API view of a link. The caller must hold us.mu.
+func (us *URLShortener) summarize(key linkKey, u URLCreation, data *URLData) linkSummary {
+	s := linkSummary{
+		Code:            key.Code,
+		Domain:          key.Domain,
+		ShortURL:        us.shortURL(key),
+		LongURL:         data.LongURL,
+		Title:           data.Title,
+		Meta:            data.Meta,
+		OpenGraph:       data.OpenGraph,
+		Health:          data.Health,
+		Disabled:        data.Disabled,
+		Fallback:        data.Fallback,
+		FallbackHits:    data.FallbackHits,
+		Notify:          data.Notify,
+		CreatedAt:       u.CreatedAt,
+		Workspace:       data.Workspace,
+		Folder:          data.Folder,
+		Tags:            data.Tags,
+		ViewCount:       data.ViewCount,
+		UniqueViewCount: len(data.UniqueViews),
+	}
+	if !data.ExpiresAt.IsZero() {
+		expires := data.ExpiresAt
+		s.ExpiresAt = &expires
+	}
+	return s
+}
+
+func (us *URLShortener) editLink(w http.ResponseWriter, r *http.Request, code string) {
+	var update linkUpdate
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+	key := linkKey{Domain: us.requestNamespace(r), Code: code}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	data, exists := us.store[key]
+	if !exists {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	if !us.canEdit(r, data) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if update.OpenGraph != nil {
+		if err := update.OpenGraph.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if update.Notify != nil {
+		if err := update.Notify.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if update.Fallback != nil {
+		*update.Fallback = strings.TrimSpace(*update.Fallback)
+		if err := validateFallback(*update.Fallback); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if update.Title != nil {
+		data.Title = strings.TrimSpace(*update.Title)
+	}
+	if update.OpenGraph != nil {
+		data.OpenGraph = update.OpenGraph
+		if data.OpenGraph.empty() {
+			data.OpenGraph = nil
+		}
+	}
+	if update.Disabled != nil {
+		data.Disabled = *update.Disabled
+	}
+	if update.Fallback != nil {
+		data.Fallback = *update.Fallback
+	}
+	if update.Notify != nil {
+		data.Notify = update.Notify
+	}
+	if update.Tags != nil {
+		data.Tags = normalizeTags(*update.Tags)
+	}
+	if update.Folder != nil {
+		data.Folder = strings.TrimSpace(*update.Folder)
+	}
+	us.index.add(key, data)
+	us.emitLinkEvent(EventLinkUpdated, key, data)
+	us.auditLink(r, AuditEdit, key, data)
+
+	var created URLCreation
+	for _, u := range us.userHistory[data.CreatorIP] {
+		if u.ShortCode == key.Code && u.Domain == key.Domain {
+			created = u
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(us.summarize(key, created, data))
+}
+
+// HandleTags reports aggregate stats per tag over the links the requester
+// may list, accepting the same ?workspace= and ?folder= filters.
+func (us *URLShortener) HandleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter := newLinkFilter(r)
+	filter.Tag = ""
+	us.mu.RLock()
+	urls, _, ok := us.visibleLinks(r, filter)
+	if !ok {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	byTag := make(map[string]*tagStats)
+	for _, u := range urls {
+		data := us.store[linkKey{Domain: u.Domain, Code: u.ShortCode}]
+		for _, tag := range data.Tags {
+			ts, ok := byTag[tag]
+			if !ok {
+				ts = &tagStats{Tag: tag}
+				byTag[tag] = ts
+			}
+			ts.Links++
+			ts.ViewCount += data.ViewCount
+			ts.UniqueViewCount += len(data.UniqueViews)
+		}
+	}
+	us.mu.RUnlock()
+
+	stats := make([]tagStats, 0, len(byTag))
+	for _, ts := range byTag {
+		stats = append(stats, *ts)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ViewCount != stats[j].ViewCount {
+			return stats[i].ViewCount > stats[j].ViewCount
+		}
+		return stats[i].Tag < stats[j].Tag
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
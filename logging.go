@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Audit actions.
+const (
+	AuditCreate = "create"
+	AuditEdit   = "edit"
+	AuditDelete = "delete"
+	AuditImport = "import"
+)
+
+// auditLevels sets the level of each audit action, so that for example
+// AUDIT_LOG_LEVEL=warn keeps only deletions and imports.
+var auditLevels = map[string]slog.Level{
+	AuditCreate: slog.LevelInfo,
+	AuditEdit:   slog.LevelInfo,
+	AuditDelete: slog.LevelWarn,
+	AuditImport: slog.LevelWarn,
+}
+
+const maxRequestIDLen = 64
+
+type requestIDKey struct{}
+
+// newLogger returns a JSON logger. dest is "stderr" (the default),
+// "stdout", "off" or a file path to append to; level is a slog level name
+// such as "debug" or "warn".
+func newLogger(dest, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	var w io.Writer
+	switch dest {
+	case "", "stderr":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	case "off":
+		w = io.Discard
+	default:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// redactIP masks the host part of an IP address: the last octet of IPv4
+// addresses and all but the first 48 bits of IPv6 addresses.
+func redactIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "redacted"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// logIP returns the requester's IP as it should appear in logs.
+func (us *URLShortener) logIP(r *http.Request) string {
+	if us.redactIPs {
+		return redactIP(us.clientIP(r))
+	}
+	return us.clientIP(r)
+}
+
+// requestID returns the ID assigned to a request by logRequests.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID keeps a well-formed X-Request-ID from a proxy in front of
+// the server, and makes one up otherwise.
+func newRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= maxRequestIDLen && strings.IndexFunc(id, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+	}) < 0 {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logRequests assigns every request an ID, returned in the X-Request-ID
+// header, and writes an access log entry once next has served it. The route
+// is the pattern that matched in mux.
+func (us *URLShortener) logRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := newRequestID(r)
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		rec := &statusRecorder{ResponseWriter: w}
+		_, route := mux.Handler(r)
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Default().LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", us.logIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+// actor describes who made a request: the admin, a workspace member, or
+// anonymous. The caller must hold us.mu.
+func (us *URLShortener) actor(r *http.Request) string {
+	if us.isAdmin(r) {
+		return "admin"
+	}
+	if key := requestKey(r); key != "" {
+		if ref, ok := us.memberKeys[hashKey(key)]; ok {
+			return "member:" + ref.Workspace + "/" + ref.Name
+		}
+	}
+	return "anonymous"
+}
+
+// auditLink records a change to a link in the audit log. The caller must
+// hold us.mu.
+func (us *URLShortener) auditLink(r *http.Request, action string, key linkKey, data *URLData) {
+	us.audit.LogAttrs(r.Context(), auditLevels[action], "link "+action,
+		slog.String("action", action),
+		slog.String("request_id", requestID(r)),
+		slog.String("actor", us.actor(r)),
+		slog.String("ip", us.logIP(r)),
+		slog.String("short_url", us.shortURL(key)),
+		slog.String("long_url", data.LongURL),
+		slog.String("workspace", data.Workspace),
+	)
+}
+
+// auditImport records an import in the audit log.
+func (us *URLShortener) auditImport(r *http.Request, source string, report importReport) {
+	if report.DryRun {
+		return
+	}
+	us.mu.RLock()
+	actor := us.actor(r)
+	us.mu.RUnlock()
+	us.audit.LogAttrs(r.Context(), auditLevels[AuditImport], "links "+AuditImport,
+		slog.String("action", AuditImport),
+		slog.String("request_id", requestID(r)),
+		slog.String("actor", actor),
+		slog.String("ip", us.logIP(r)),
+		slog.String("source", source),
+		slog.Int("imported", report.Imported),
+		slog.Int("overwritten", report.Overwritten),
+		slog.Int("renamed", len(report.Renamed)),
+	)
+}
@@ -1,23 +1,54 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
+	"io"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 const (
 	base62Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	codeLength  = 7 // Fixed length for the short code
+
+	minAliasLength = 3
+	maxAliasLength = 64
+
+	maxJSONBodyBytes = 1 << 20 // 1 MB, for single JSON request bodies
 )
 
+// reservedPaths are first path segments served by the application itself,
+// which can therefore never be used as custom aliases.
+var reservedPaths = map[string]bool{
+	"shorten":    true,
+	"stats":      true,
+	"history":    true,
+	"preview":    true,
+	"delete":     true,
+	"workspaces": true,
+	"api":        true,
+	"admin":      true,
+	"metrics":    true,
+	"healthz":    true,
+	"readyz":     true,
+	"static":     true,
+}
+
 // Add these new types to track user information and URL history
 type UserInfo struct {
 	IP        string    `json:"ip"`
@@ -30,31 +61,102 @@ type UserInfo struct {
 
 type URLCreation struct {
 	ShortCode       string
+	Domain          string // registered host, "" for the default domain
 	LongURL         string
 	CreatedAt       time.Time
 	UserInfo        UserInfo
 	ViewCount       int // Add this field
 	UniqueViewCount int // Add this field
+	Title           string
+	Meta            *PageMeta
+	Health          *LinkHealth
+	Disabled        bool
+	Tags            []string
+	Folder          string
 }
 
 // Modify URLShortener struct to include user tracking
 type URLShortener struct {
-	mu          sync.RWMutex
-	store       map[string]*URLData
-	userHistory map[string][]URLCreation // IP -> URLs created by user
-	domain      string
+	mu           sync.RWMutex
+	store        map[linkKey]*URLData
+	userHistory  map[string][]URLCreation // IP -> URLs created by user
+	domain       string
+	domains      map[string]*Domain // host -> additional branded domain
+	workspaces   map[string]*Workspace
+	memberKeys   map[string]memberRef          // member key hash -> member
+	index        *searchIndex                  // full-text index over links
+	meta         *metaFetcher                  // optional, fetches destination metadata
+	checker      *linkChecker                  // optional, checks destinations for rot
+	fallback     string                        // default domain's fallback URL
+	fallbackHits uint64                        // unknown codes on the default domain sent to fallback
+	errorPages   map[int]*template.Template    // custom 404 and 410 pages
+	templates    map[string]*template.Template // page templates overridden from TEMPLATES_DIR
+	branding     Branding                      // instance branding, over the built-in one
+	webhooks     *webhookDispatcher
+	notify       *notifyCenter          // optional, milestone and anomaly alerts
+	clickRates   map[linkKey]*clickRate // anomaly detector state
+	metrics      *Metrics               // request counts and latencies for /metrics
+	audit        *slog.Logger           // who created, edited and deleted which link
+	redactIPs    bool                   // mask client IPs in the access and audit logs
+	proxies      []*net.IPNet           // trusted reverse proxies, whose X-Forwarded-For is believed
+	limiter      *rateLimiter           // optional, caps shorten requests per client
+	snapshot     *snapshotStatus        // set when the store is saved to DATA_FILE
+	geo          *geoDB                 // optional, enables country rules
+	adminToken   string                 // bearer token for /admin/ endpoints, empty disables them
 }
 
 // URLData holds the original long URL and view metrics.
 type URLData struct {
-	LongURL     string
-	ViewCount   uint64
-	UniqueViews map[string]bool
+	LongURL      string
+	Title        string      // set by the creator, overrides Meta.Title
+	Meta         *PageMeta   // destination page metadata, once fetched
+	OpenGraph    *OpenGraph  // optional overrides for social previews
+	Health       *LinkHealth // latest destination check, if any
+	Disabled     bool        // temporarily switched off by its owner
+	Fallback     string      // where to send visitors when the link is unavailable
+	FallbackHits uint64
+	Notify       *NotifyRule // overrides the default milestone and spike alerts
+	ViewCount    uint64
+	UniqueViews  map[string]bool
+	Rules        []RedirectRule
+	RuleHits     map[string]uint64 // rule name -> redirects it served
+	Variants     []Variant         // optional A/B split of the default destination
+	ExpiresAt    time.Time         // zero if the link never expires
+	Tags         []string
+	Folder       string // optional folder for organizing links
+	Workspace    string // owning workspace, "" for a personal link
+	CreatorIP    string // owner of a personal link
+}
+
+// displayTitle returns the creator's title for the link, falling back to
+// the destination page's title.
+func (d *URLData) displayTitle() string {
+	if d.Title == "" && d.Meta != nil {
+		return d.Meta.Title
+	}
+	return d.Title
+}
+
+// expired reports whether the link is past its expiry time.
+func (d *URLData) expired() bool {
+	return !d.ExpiresAt.IsZero() && time.Now().After(d.ExpiresAt)
 }
 
 // shortenRequest and shortenResponse define the JSON request/response for shortening URLs.
 type shortenRequest struct {
-	URL string `json:"url"`
+	URL       string         `json:"url"`
+	Alias     string         `json:"alias,omitempty"`
+	Title     string         `json:"title,omitempty"`
+	OpenGraph *OpenGraph     `json:"og,omitempty"`
+	Fallback  string         `json:"fallback_url,omitempty"`
+	Notify    *NotifyRule    `json:"notify,omitempty"`
+	Domain    string         `json:"domain,omitempty"`
+	Workspace string         `json:"workspace,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Folder    string         `json:"folder,omitempty"`
+	Rules     []RedirectRule `json:"rules,omitempty"`
+	Variants  []Variant      `json:"variants,omitempty"`
 }
 
 type shortenResponse struct {
@@ -64,16 +166,38 @@ type shortenResponse struct {
 // URLStats holds data to be displayed on the stats page.
 type URLStats struct {
 	LongURL         string
+	Title           string
+	Meta            *PageMeta
+	Health          *LinkHealth
+	Disabled        bool
+	Expired         bool
+	Fallback        string
+	FallbackHits    uint64
 	ViewCount       uint64
 	UniqueViewCount int
+	RuleHits        []RuleHit
+	Variants        []VariantStats
+	Brand           Branding
+	Locale          *Locale
 }
 
 // Update NewURLShortener to initialize userHistory
 func NewURLShortener(domain string) *URLShortener {
 	return &URLShortener{
-		store:       make(map[string]*URLData),
+		store:       make(map[linkKey]*URLData),
 		userHistory: make(map[string][]URLCreation),
 		domain:      domain,
+		domains:     make(map[string]*Domain),
+		workspaces:  make(map[string]*Workspace),
+		memberKeys:  make(map[string]memberRef),
+		index:       newSearchIndex(),
+		errorPages:  make(map[int]*template.Template),
+		templates:   make(map[string]*template.Template),
+		branding:    defaultBranding,
+		webhooks:    newWebhookDispatcher(),
+		clickRates:  make(map[linkKey]*clickRate),
+		metrics:     NewMetrics(),
+		audit:       slog.New(slog.NewJSONHandler(io.Discard, nil)),
 	}
 }
 
@@ -81,42 +205,50 @@ func NewURLShortener(domain string) *URLShortener {
 func parseUserAgent(userAgent string) (browser, os, device string) {
 	ua := strings.ToLower(userAgent)
 
-	// Parse browser
+	// Parse browser. Order matters: Edge and Opera also advertise Chrome,
+	// and every Chromium browser advertises Safari.
 	switch {
-	case strings.Contains(ua, "firefox"):
+	case strings.Contains(ua, "edg"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "samsungbrowser"):
+		browser = "Samsung Internet"
+	case strings.Contains(ua, "firefox") || strings.Contains(ua, "fxios"):
 		browser = "Firefox"
-	case strings.Contains(ua, "chrome"):
+	case strings.Contains(ua, "chrome") || strings.Contains(ua, "crios"):
 		browser = "Chrome"
 	case strings.Contains(ua, "safari"):
 		browser = "Safari"
-	case strings.Contains(ua, "edge"):
-		browser = "Edge"
 	default:
 		browser = "Unknown"
 	}
 
-	// Parse OS
+	// Parse OS. Android reports Linux and iOS reports "like Mac OS X",
+	// so the mobile platforms are checked first.
 	switch {
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod"):
+		os = "iOS"
 	case strings.Contains(ua, "windows"):
 		os = "Windows"
 	case strings.Contains(ua, "mac"):
 		os = "MacOS"
 	case strings.Contains(ua, "linux"):
 		os = "Linux"
-	case strings.Contains(ua, "android"):
-		os = "Android"
-	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
-		os = "iOS"
 	default:
 		os = "Unknown"
 	}
 
-	// Parse device type
+	// Parse device type. Android tablets omit "mobile" from their UA.
 	switch {
-	case strings.Contains(ua, "mobile"):
-		device = "Mobile"
-	case strings.Contains(ua, "tablet"):
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
 		device = "Tablet"
+	case strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		device = "Tablet"
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone"):
+		device = "Mobile"
 	default:
 		device = "Desktop"
 	}
@@ -132,60 +264,223 @@ func (us *URLShortener) HandleShorten(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req shortenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
-	if req.URL == "" {
-		http.Error(w, "URL is required", http.StatusBadRequest)
+	data, err := newURLData(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get user information
-	ip := getIP(r)
+	// Store URL and update user history
+	userInfo := us.newUserInfo(r)
+	us.mu.Lock()
+	domain, err := us.createDomain(req.Domain, r.Host)
+	if err != nil {
+		us.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := us.checkCreate(r, req.Workspace); err != nil {
+		us.mu.Unlock()
+		status := http.StatusBadRequest
+		if errors.Is(err, errForbidden) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	key, err := us.assignCode(domain, req.Alias)
+	if err == nil {
+		us.insertLink(key, data, userInfo)
+		us.emitLinkEvent(EventLinkCreated, key, data)
+		us.auditLink(r, AuditCreate, key, data)
+	}
+	us.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	us.queueMetadata(key, data.LongURL)
+
+	resp := shortenResponse{ShortURL: us.shortURL(key)}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newUserInfo captures who is creating a link.
+func (us *URLShortener) newUserInfo(r *http.Request) UserInfo {
 	browser, os, device := parseUserAgent(r.UserAgent())
-	userInfo := UserInfo{
-		IP:        ip,
+	return UserInfo{
+		IP:        us.clientIP(r),
 		UserAgent: r.UserAgent(),
 		Browser:   browser,
 		OS:        os,
 		Device:    device,
 		CreatedAt: time.Now(),
 	}
+}
+
+// newURLData validates a shorten request and builds the link it describes.
+func newURLData(req shortenRequest) (*URLData, error) {
+	if req.URL == "" {
+		return nil, errors.New("URL is required")
+	}
+	if req.Alias != "" {
+		if err := validateAlias(req.Alias); err != nil {
+			return nil, err
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	if err := validateRules(req.Rules); err != nil {
+		return nil, err
+	}
+	if err := validateFallback(req.Fallback); err != nil {
+		return nil, err
+	}
+	if req.Notify != nil {
+		if err := req.Notify.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if req.OpenGraph != nil {
+		if err := req.OpenGraph.validate(); err != nil {
+			return nil, err
+		}
+		if req.OpenGraph.empty() {
+			req.OpenGraph = nil
+		}
+	}
+	if err := validateVariants(req.Variants); err != nil {
+		return nil, err
+	}
+	for i := range req.Variants {
+		req.Variants[i].Clicks = 0
+	}
 
-	// Generate code and create URL data
-	code := us.generateShortCode()
 	data := &URLData{
 		LongURL:     req.URL,
+		Title:       strings.TrimSpace(req.Title),
+		OpenGraph:   req.OpenGraph,
+		Fallback:    req.Fallback,
+		Notify:      req.Notify,
 		ViewCount:   0,
 		UniqueViews: make(map[string]bool),
+		Rules:       req.Rules,
+		RuleHits:    make(map[string]uint64),
+		Variants:    req.Variants,
+		Tags:        normalizeTags(req.Tags),
+		Folder:      strings.TrimSpace(req.Folder),
+		Workspace:   req.Workspace,
+	}
+	if req.ExpiresAt != nil {
+		data.ExpiresAt = *req.ExpiresAt
 	}
+	return data, nil
+}
 
-	// Store URL and update user history
-	us.mu.Lock()
-	us.store[code] = data
+// createDomain picks the namespace for a new link: the requested domain,
+// which must be registered, or else the domain the request arrived on. The
+// caller must hold us.mu.
+func (us *URLShortener) createDomain(requested, host string) (string, error) {
+	if requested == "" {
+		return us.namespace(host), nil
+	}
+	requested = normalizeHost(requested)
+	if _, ok := us.domains[requested]; !ok {
+		return "", fmt.Errorf("domain %q is not registered", requested)
+	}
+	return requested, nil
+}
+
+// assignCode returns alias if it is free on domain, or a new random code when
+// alias is empty. The caller must hold us.mu.
+func (us *URLShortener) assignCode(domain, alias string) (linkKey, error) {
+	if alias != "" {
+		key := linkKey{Domain: domain, Code: alias}
+		if _, taken := us.store[key]; taken {
+			return linkKey{}, fmt.Errorf("alias %q is already taken", alias)
+		}
+		return key, nil
+	}
+	for {
+		key := linkKey{Domain: domain, Code: us.generateShortCode()}
+		if _, taken := us.store[key]; !taken {
+			return key, nil
+		}
+	}
+}
+
+// insertLink stores a link and records it in its creator's history. The
+// caller must hold us.mu.
+func (us *URLShortener) insertLink(key linkKey, data *URLData, userInfo UserInfo) {
+	data.CreatorIP = userInfo.IP
+	us.store[key] = data
+	us.index.add(key, data)
 	urlCreation := URLCreation{
-		ShortCode: code,
-		LongURL:   req.URL,
-		CreatedAt: time.Now(),
+		ShortCode: key.Code,
+		Domain:    key.Domain,
+		LongURL:   data.LongURL,
+		CreatedAt: userInfo.CreatedAt,
 		UserInfo:  userInfo,
 	}
-	us.userHistory[ip] = append(us.userHistory[ip], urlCreation)
-	us.mu.Unlock()
+	us.userHistory[userInfo.IP] = append(us.userHistory[userInfo.IP], urlCreation)
+}
 
-	shortURL := fmt.Sprintf("%s/%s", us.domain, code)
-	resp := shortenResponse{ShortURL: shortURL}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+// shortURL returns the public URL for a link. The caller must hold us.mu.
+func (us *URLShortener) shortURL(key linkKey) string {
+	if d, ok := us.domains[key.Domain]; ok {
+		return fmt.Sprintf("%s/%s", d.baseURL(), key.Code)
+	}
+	return fmt.Sprintf("%s/%s", us.domain, key.Code)
+}
+
+// validateAlias checks that a custom alias is usable as a short code.
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("alias must be between %d and %d characters", minAliasLength, maxAliasLength)
+	}
+	for _, c := range alias {
+		if !strings.ContainsRune(base62Chars, c) && c != '-' && c != '_' {
+			return fmt.Errorf("alias %q may only contain letters, digits, '-' and '_'", alias)
+		}
+	}
+	if reservedPaths[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// normalizeTags trims, lower-cases and de-duplicates tags.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
 }
 
 // generateShortCode returns a base62-encoded string from a random integer.
+// Codes that collide with reservedPaths are drawn again, since the
+// application's own routes would shadow them.
 func (us *URLShortener) generateShortCode() string {
 	// Seed the random generator (ideally, do this once in your program's initialization)
 	rand.Seed(time.Now().UnixNano())
-	// Generate a random int64 value.
-	num := rand.Int63()
-	return encodeBase62(num)
+	for {
+		// Generate a random int64 value.
+		code := encodeBase62(rand.Int63())
+		if !reservedPaths[strings.ToLower(code)] {
+			return code
+		}
+	}
 }
 
 // encodeBase62 converts a number to a base62 string and pads it to a fixed length.
@@ -218,34 +513,114 @@ func encodeBase62(num int64) string {
 func (us *URLShortener) HandleRedirect(w http.ResponseWriter, r *http.Request) {
 	// If path is "/" serve the home page.
 	if r.URL.Path == "/" {
-		serveHomePage(w, r)
-		return
-	}
-
-	// If the path starts with "/stats", let the stats handler take over.
-	if strings.HasPrefix(r.URL.Path, "/stats") {
-		us.HandleStats(w, r)
+		// Branded domains may send their root elsewhere.
+		us.mu.RLock()
+		var root string
+		if d, ok := us.domains[us.namespace(r.Host)]; ok {
+			root = d.RootRedirect
+		}
+		us.mu.RUnlock()
+		if root != "" {
+			http.Redirect(w, r, root, http.StatusFound)
+			return
+		}
+		us.serveHomePage(w, r)
 		return
 	}
 
 	// Otherwise, assume the path is a short code.
 	code := r.URL.Path[1:]
+	v := us.newVisitor(r)
+	assigned := assignedVariant(r, code)
+	crawler := isCrawler(r.UserAgent())
+	var target string
+	var cookie *http.Cookie
+	var card *socialCard
+	var unavailable *ErrorPage
+	var click *webhookEvent
+	var alerts []Notification
 	us.mu.Lock()
-	data, exists := us.store[code]
-	if exists {
+	key := linkKey{Domain: us.namespace(r.Host), Code: code}
+	data, exists := us.store[key]
+	switch {
+	case !exists:
+		unavailable = &ErrorPage{Status: http.StatusNotFound, Title: "Link not found", Message: "There is no link at this address."}
+	case data.Disabled:
+		unavailable = &ErrorPage{Status: http.StatusGone, Title: "Link disabled", Message: "The owner of this link has switched it off."}
+	case data.expired():
+		unavailable = &ErrorPage{Status: http.StatusGone, Title: "Link expired", Message: "This link is no longer available."}
+	}
+	// Unavailable links, and links whose destination is known to be broken,
+	// go to a fallback if one is set.
+	broken := unavailable == nil && data.Health != nil && data.Health.Broken
+	if unavailable != nil || broken {
+		if target = us.fallbackFor(key.Domain, data); target != "" {
+			us.recordFallback(key.Domain, data)
+		}
+	}
+	if unavailable == nil && target == "" && crawler {
+		// Unfurlers get a page of Open Graph tags, and are not counted as
+		// views.
+		card = us.socialCard(key, data)
+	} else if unavailable == nil && target == "" {
 		// Increment total view count.
 		data.ViewCount++
 		// Track unique views based on IP.
-		ip := getIP(r)
+		ip := us.clientIP(r)
 		data.UniqueViews[ip] = true
+
+		// The first matching rule wins, otherwise fall back to LongURL or,
+		// for split links, the visitor's variant.
+		target = data.LongURL
+		rule := defaultRuleName
+		if i := matchRule(data.Rules, v); i >= 0 {
+			target = data.Rules[i].URL
+			rule = data.Rules[i].label(i)
+		} else if len(data.Variants) > 0 {
+			i := pickVariant(data.Variants, assigned)
+			data.Variants[i].Clicks++
+			target = data.Variants[i].URL
+			if label := data.Variants[i].label(i); label != assigned {
+				cookie = variantCookie(code, label)
+			}
+		}
+		if len(data.Rules) > 0 {
+			data.RuleHits[rule]++
+		}
+		click = &webhookEvent{
+			Type: EventLinkClicked,
+			Data: webhookClick{
+				webhookLink: us.webhookLink(key, data),
+				Target:      target,
+				Browser:     v.Browser,
+				OS:          v.OS,
+				Device:      v.Device,
+				Country:     v.Country,
+			},
+			workspace: data.Workspace,
+		}
+		alerts = us.clickAlerts(key, data, v.Time)
 	}
 	us.mu.Unlock()
+	if click != nil {
+		us.webhooks.emit(*click)
+	}
+	if len(alerts) > 0 {
+		us.sendNotifications(alerts)
+	}
 
-	if !exists {
-		http.Error(w, "URL not found", http.StatusNotFound)
+	if unavailable != nil && target == "" {
+		us.serveErrorPage(w, r, *unavailable)
+		return
+	}
+	if card != nil {
+		us.serveSocialCard(w, card)
 		return
 	}
-	http.Redirect(w, r, data.LongURL, http.StatusFound)
+	if cookie != nil {
+		http.SetCookie(w, cookie)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
 }
 
 // HandleStats displays details for a given short code.
@@ -256,69 +631,337 @@ func (us *URLShortener) HandleStats(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Stats code not provided", http.StatusBadRequest)
 		return
 	}
-	code := parts[2]
+	key := linkKey{Domain: us.requestNamespace(r), Code: parts[2]}
 
 	us.mu.RLock()
-	data, exists := us.store[code]
+	data, exists := us.store[key]
+	if exists && !us.canView(r, data) {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var stats URLStats
+	if exists {
+		stats = URLStats{
+			LongURL:         data.LongURL,
+			Title:           data.displayTitle(),
+			Meta:            data.Meta,
+			Health:          data.Health,
+			Disabled:        data.Disabled,
+			Expired:         data.expired(),
+			Fallback:        data.Fallback,
+			FallbackHits:    data.FallbackHits,
+			ViewCount:       data.ViewCount,
+			UniqueViewCount: len(data.UniqueViews),
+			RuleHits:        ruleHits(data),
+			Variants:        variantStats(data),
+		}
+	}
+	stats.Brand = us.brandingFor(us.namespace(r.Host))
 	us.mu.RUnlock()
+	stats.Locale = localeFor(w, r)
 
 	if !exists {
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	stats := URLStats{
-		LongURL:         data.LongURL,
-		ViewCount:       data.ViewCount,
-		UniqueViewCount: len(data.UniqueViews),
-	}
-
 	w.Header().Set("Content-Type", "text/html")
-	if err := statsTemplate.Execute(w, stats); err != nil {
+	if err := us.template("stats.html").Execute(w, stats); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
-// getIP extracts the IP address from the request, considering the possibility of proxy headers.
-func getIP(r *http.Request) string {
-	// Check X-Forwarded-For header (if behind a proxy)
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
+// decodeJSON decodes a JSON request body of at most maxJSONBodyBytes into v,
+// writing an error response if it cannot.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	case err != nil:
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return false
 	}
-	// Fallback to remote address.
+	return true
+}
+
+// clientIP returns the requester's IP address. X-Forwarded-For is only
+// believed on connections from a trusted proxy, and only back to the
+// rightmost address that is not itself a trusted proxy, since anything to
+// the left of that was written by the client.
+func (us *URLShortener) clientIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return r.RemoteAddr
+		ip = r.RemoteAddr
+	}
+	if !us.trustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !us.trustedProxy(hop) {
+			break
+		}
 	}
 	return ip
 }
 
+// trustedProxy reports whether ip belongs to a reverse proxy listed in
+// TRUSTED_PROXIES.
+func (us *URLShortener) trustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	for _, n := range us.proxies {
+		if addr != nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies reads the TRUSTED_PROXIES setting: IP addresses and
+// CIDR ranges.
+func parseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		cidr := s
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// HomeData is the data for the home page.
+type HomeData struct {
+	Brand  Branding
+	Locale *Locale
+}
+
 // serveHomePage renders the home page.
-func serveHomePage(w http.ResponseWriter, r *http.Request) {
+func (us *URLShortener) serveHomePage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
-	if err := homeTemplate.Execute(w, nil); err != nil {
+	if err := us.template("home.html").Execute(w, HomeData{Brand: us.requestBranding(r), Locale: localeFor(w, r)}); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
 func main() {
-	shortener := NewURLShortener(os.Getenv("DOMAIN"))
+	// Subcommands such as "export" and "import" talk to a running server.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
+	cfg, printConfig, err := LoadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if printConfig {
+		cfg.WriteTOML(os.Stdout)
+		return
+	}
+
+	// JSON logs: the server and access log, and the audit log of link
+	// changes, which goes to its own file when AUDIT_LOG is a path.
+	logger, err := newLogger(cfg.LogOutput, cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid LOG_OUTPUT: %v", err)
+	}
+	slog.SetDefault(logger)
+	audit, err := newLogger(cfg.AuditLog, cfg.AuditLogLevel)
+	if err != nil {
+		log.Fatalf("Invalid AUDIT_LOG: %v", err)
+	}
+
+	shortener := NewURLShortener(cfg.Domain)
+	shortener.adminToken = cfg.AdminToken
+	shortener.audit = audit.With("log", "audit")
+	shortener.redactIPs = cfg.RedactIPs
+	shortener.proxies, err = parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Additional branded domains, each with its own code namespace.
+	domains, err := parseDomains(strings.Join(cfg.Domains, ","))
+	if err != nil {
+		log.Fatalf("Invalid DOMAINS: %v", err)
+	}
+	for _, d := range domains {
+		if _, err := shortener.AddDomain(d); err != nil {
+			log.Fatalf("Invalid DOMAINS: %v", err)
+		}
+	}
+
+	// Links and their counters survive restarts in DATA_FILE, saved every
+	// SNAPSHOT_INTERVAL and on shutdown.
+	if cfg.DataFile != "" {
+		if err := shortener.LoadSnapshot(cfg.DataFile); err != nil {
+			log.Fatalf("Failed to load DATA_FILE: %v", err)
+		}
+		shortener.StartSnapshots(cfg.DataFile, cfg.SnapshotInterval)
+	}
+
+	// Optional country database for geo-targeted redirect rules.
+	if cfg.GeoIPDB != "" {
+		geo, err := loadGeoDB(cfg.GeoIPDB)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		shortener.geo = geo
+	}
+
+	// Where unavailable links on the default domain send visitors, and
+	// custom 404.html and 410.html pages.
+	shortener.fallback = cfg.Fallback
+	if cfg.ErrorPages != "" {
+		if err := shortener.LoadErrorPages(cfg.ErrorPages); err != nil {
+			log.Fatalf("Failed to load error pages: %v", err)
+		}
+	}
+
+	// White-label branding, and page templates replaced from TEMPLATES_DIR.
+	shortener.SetBranding(cfg.Branding)
+	if cfg.TemplatesDir != "" {
+		if err := shortener.LoadTemplates(cfg.TemplatesDir); err != nil {
+			log.Fatalf("Failed to load templates: %v", err)
+		}
+	}
+
+	// Click milestone and traffic spike notifications.
+	var notifiers []Notifier
+	if cfg.NotifyWebhookURL != "" {
+		notifiers = append(notifiers, &WebhookNotifier{URL: cfg.NotifyWebhookURL, Client: &http.Client{Timeout: notifyTimeout}})
+	}
+	if cfg.SMTP.Addr != "" {
+		smtp := cfg.SMTP
+		notifiers = append(notifiers, &smtp)
+	}
+	if cfg.NotifyLog {
+		notifiers = append(notifiers, LogNotifier{})
+	}
+	shortener.StartNotifications(notifiers, cfg.NotifyMilestones, cfg.NotifySpikeFactor)
+
+	// Background fetching of destination titles, descriptions and images.
+	// METADATA_WORKERS=0 turns it off.
+	if cfg.MetadataWorkers > 0 {
+		shortener.StartMetadataWorkers(cfg.MetadataWorkers, cfg.MetadataAllowPrivate)
+	}
+
+	// Periodic checks of every destination. LINK_CHECK_INTERVAL=0 turns
+	// them off.
+	if cfg.LinkCheckInterval > 0 {
+		shortener.StartLinkChecker(cfg.LinkCheckInterval, cfg.LinkCheckFailures, cfg.LinkCheckAllowPrivate)
+	}
+
+	// Link creation is capped per client when RATE_LIMIT is set.
+	if cfg.RateLimit > 0 {
+		shortener.limiter = newRateLimiter(cfg.RateLimit)
+	}
+
+	// Request counts and latencies are recorded per handler for /metrics.
+	m := shortener.metrics
 	// API endpoint to shorten URLs.
-	http.HandleFunc("/shorten", shortener.HandleShorten)
+	http.HandleFunc("/shorten", m.Instrument("shorten", shortener.rateLimit("shorten", shortener.HandleShorten)))
+	// Bulk creation from a JSON array or CSV upload.
+	http.HandleFunc("/shorten/bulk", m.Instrument("bulk", shortener.rateLimit("bulk", shortener.HandleBulkShorten)))
 	// /stats/{code} for URL statistics.
-	http.HandleFunc("/stats/", shortener.HandleStats)
+	http.HandleFunc("/stats/", m.Instrument("stats", shortener.HandleStats))
+	// /preview/{code} shows where a link goes without following it.
+	http.HandleFunc("/preview/", m.Instrument("preview", shortener.HandlePreview))
 	// All other requests handled by HandleRedirect (home page or redirection).
-	http.HandleFunc("/", shortener.HandleRedirect)
+	http.HandleFunc("/", m.Instrument("redirect", shortener.HandleRedirect))
 	// Add the new route in main()
-	http.HandleFunc("/history", shortener.HandleHistory)
-	http.HandleFunc("/delete/", shortener.HandleDelete)
+	http.HandleFunc("/history", m.Instrument("history", shortener.HandleHistory))
+	http.HandleFunc("/delete/", m.Instrument("delete", shortener.HandleDelete))
+	// Link list and edit API, and per-tag stats.
+	http.HandleFunc("/api/links", m.Instrument("links", shortener.HandleLinks))
+	http.HandleFunc("/api/links/", m.Instrument("links", shortener.HandleLinks))
+	http.HandleFunc("/api/tags", m.Instrument("tags", shortener.HandleTags))
+	http.HandleFunc("/api/search", m.Instrument("search", shortener.HandleSearch))
+	http.HandleFunc("/api/broken", m.Instrument("broken", shortener.HandleBroken))
+	// Workspaces for shared link ownership.
+	http.HandleFunc("/workspaces", m.Instrument("workspaces", shortener.HandleWorkspaces))
+	http.HandleFunc("/workspaces/", m.Instrument("workspaces", shortener.HandleWorkspaces))
+	// Admin endpoints, enabled by setting ADMIN_TOKEN.
+	http.HandleFunc("/admin/export", shortener.HandleExport)
+	http.HandleFunc("/admin/import", shortener.HandleImport)
+	http.HandleFunc("/admin/import/external", shortener.HandleExternalImport)
+	http.HandleFunc("/admin/domains", shortener.HandleDomains)
+	http.HandleFunc("/admin/domains/", shortener.HandleDomains)
+	http.HandleFunc("/admin/webhooks", shortener.HandleWebhooks)
+	http.HandleFunc("/admin/webhooks/", shortener.HandleWebhooks)
+	http.HandleFunc("/admin/notifications", shortener.HandleNotifications)
+	// Embedded scripts and styles.
+	http.HandleFunc("/static/", HandleStatic)
+	// Liveness and readiness probes.
+	http.HandleFunc("/healthz", shortener.HandleHealthz)
+	http.HandleFunc("/readyz", shortener.HandleReadyz)
+
+	// Browser security headers and CSRF checks apply to every page and API.
+	mux := http.DefaultServeMux
+	app := shortener.logRequests(mux, withSecurityHeaders(cfg.CSP, csrfProtect(mux)))
+	servers := []*http.Server{cfg.HTTP.newServer(fmt.Sprintf(":%s", cfg.Port), app)}
+
+	// HTTPS on the main port when a certificate is configured, plus an
+	// optional plain HTTP port that redirects to it.
+	if cfg.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		servers[0].TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+		servers[0].Handler = withHSTS(cfg.HSTSMaxAge, app)
+		if cfg.HTTPPort != "" {
+			redirect := httpsRedirect(cfg.Port, cfg.HTTPServeLinks, mux, app)
+			servers = append(servers, cfg.HTTP.newServer(fmt.Sprintf(":%s", cfg.HTTPPort), redirect))
+		}
+	}
 
-	port := "8080"
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
+	// Prometheus metrics, on their own listener if METRICS_ADDR is set so
+	// they can stay off the public port.
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", shortener.HandleMetrics)
+		servers = append(servers, cfg.HTTP.newServer(cfg.MetricsAddr, metricsMux))
+		slog.Info("Metrics served", "addr", cfg.MetricsAddr)
+	} else {
+		http.HandleFunc("/metrics", shortener.HandleMetrics)
+	}
+
+	// SIGTERM and Ctrl-C stop new connections and drain in-flight requests
+	// before the final snapshot.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("Server started", "port", cfg.Port)
+	err = cfg.HTTP.serve(ctx, servers...)
+	if cfg.DataFile != "" {
+		if err := shortener.SaveSnapshot(cfg.DataFile); err != nil {
+			slog.Error("Saving snapshot failed", "path", cfg.DataFile, "err", err)
+		} else {
+			slog.Info("Snapshot saved", "path", cfg.DataFile)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
-	fmt.Println("Server started at :", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
 }
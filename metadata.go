@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	metaFetchTimeout  = 10 * time.Second
+	metaDialTimeout   = 5 * time.Second
+	metaMaxBodyBytes  = 1 << 20 // only the head of a page is needed
+	metaMaxRedirects  = 5
+	metaQueueSize     = 1000
+	metaFieldMaxRunes = 500
+)
+
+// PageMeta describes the destination page of a link, as fetched by the
+// metadata worker after the link was created.
+type PageMeta struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	Image       string    `json:"image,omitempty"` // og:image
+	FetchedAt   time.Time `json:"fetched_at"`
+	Error       string    `json:"error,omitempty"` // why the last fetch failed
+}
+
+// metaJob asks for the metadata of a link's destination.
+type metaJob struct {
+	Key     linkKey
+	LongURL string
+}
+
+// metaFetcher fetches page metadata in the background.
+type metaFetcher struct {
+	client *http.Client
+	jobs   chan metaJob
+}
+
+// errPrivateAddress is returned when a fetch would reach a private network.
+var errPrivateAddress = errors.New("destination resolves to a private address")
+
+// newSafeTransport returns a transport whose connections refuse loopback,
+// private, link-local and other non-public addresses unless allowPrivate is
+// set. The check runs on the resolved address of every connection, so it
+// also covers redirects and DNS names that point inside the network.
+func newSafeTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: metaDialTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(ap.Addr()) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   metaDialTimeout,
+		ResponseHeaderTimeout: metaFetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// newMetaFetcher returns a fetcher that only reaches public addresses unless
+// allowPrivate is set.
+func newMetaFetcher(allowPrivate bool) *metaFetcher {
+	return &metaFetcher{
+		client: &http.Client{
+			Transport: newSafeTransport(allowPrivate),
+			Timeout:   metaFetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= metaMaxRedirects {
+					return fmt.Errorf("stopped after %d redirects", metaMaxRedirects)
+				}
+				return nil
+			},
+		},
+		jobs: make(chan metaJob, metaQueueSize),
+	}
+}
+
+// isPublicAddr reports whether addr is a globally routable unicast address.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonPublicPrefixes are ranges that IsGlobalUnicast and IsPrivate miss.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach IPv4 private ranges
+}
+
+// StartMetadataWorkers starts n goroutines that fetch destination metadata
+// for newly created links.
+func (us *URLShortener) StartMetadataWorkers(n int, allowPrivate bool) {
+	us.meta = newMetaFetcher(allowPrivate)
+	for i := 0; i < n; i++ {
+		go us.metaWorker()
+	}
+}
+
+// queueMetadata schedules a metadata fetch for a link. It never blocks: if
+// the queue is full the link is left without metadata.
+func (us *URLShortener) queueMetadata(key linkKey, longURL string) {
+	if us.meta == nil {
+		return
+	}
+	select {
+	case us.meta.jobs <- metaJob{Key: key, LongURL: longURL}:
+	default:
+		slog.Warn("Metadata queue full, skipping link", "long_url", longURL)
+	}
+}
+
+func (us *URLShortener) metaWorker() {
+	for job := range us.meta.jobs {
+		meta := us.meta.fetch(context.Background(), job.LongURL)
+
+		us.mu.Lock()
+		// The link may have been deleted or replaced while we were fetching.
+		if data, ok := us.store[job.Key]; ok && data.LongURL == job.LongURL {
+			data.Meta = meta
+			us.index.add(job.Key, data)
+		}
+		us.mu.Unlock()
+	}
+}
+
+// fetch downloads the start of a page and extracts its metadata. Failures
+// are recorded in the returned PageMeta rather than returned.
+func (f *metaFetcher) fetch(ctx context.Context, pageURL string) *PageMeta {
+	meta := &PageMeta{FetchedAt: time.Now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		meta.Error = err.Error()
+		return meta
+	}
+	req.Header.Set("User-Agent", "url-shortner-preview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		meta.Error = err.Error()
+		return meta
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		meta.Error = resp.Status
+		return meta
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		meta.Error = fmt.Sprintf("not an HTML page (%s)", mediaType)
+		return meta
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, metaMaxBodyBytes))
+	if err != nil {
+		meta.Error = err.Error()
+		return meta
+	}
+	parsed := parsePageMeta(string(body), resp.Request.URL)
+	parsed.FetchedAt = meta.FetchedAt
+	return parsed
+}
+
+var (
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	tagPattern   = regexp.MustCompile(`(?is)<(meta|link)\s[^>]*>`)
+	attrPattern  = regexp.MustCompile(`(?s)([a-zA-Z_:.-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// parsePageMeta extracts metadata from an HTML document. Open Graph values
+// take precedence over the plain title and description. Relative favicon and
+// image URLs are resolved against base.
+func parsePageMeta(doc string, base *url.URL) *PageMeta {
+	meta := &PageMeta{}
+	if m := titlePattern.FindStringSubmatch(doc); m != nil {
+		meta.Title = cleanMetaText(m[1])
+	}
+
+	var ogTitle, ogDescription string
+	for _, tag := range tagPattern.FindAllStringSubmatch(doc, -1) {
+		attrs := parseAttrs(tag[0])
+		if strings.EqualFold(tag[1], "link") {
+			rels := strings.Fields(strings.ToLower(attrs["rel"]))
+			for _, rel := range rels {
+				if rel == "icon" && meta.Favicon == "" && attrs["href"] != "" {
+					meta.Favicon = resolveMetaURL(base, attrs["href"])
+				}
+			}
+			continue
+		}
+		name := strings.ToLower(attrs["property"])
+		if name == "" {
+			name = strings.ToLower(attrs["name"])
+		}
+		content := attrs["content"]
+		switch name {
+		case "og:title":
+			ogTitle = cleanMetaText(content)
+		case "og:description":
+			ogDescription = cleanMetaText(content)
+		case "description":
+			if meta.Description == "" {
+				meta.Description = cleanMetaText(content)
+			}
+		case "og:image", "og:image:url", "og:image:secure_url":
+			if meta.Image == "" && content != "" {
+				meta.Image = resolveMetaURL(base, content)
+			}
+		}
+	}
+	if ogTitle != "" {
+		meta.Title = ogTitle
+	}
+	if ogDescription != "" {
+		meta.Description = ogDescription
+	}
+	if meta.Favicon == "" && base != nil {
+		meta.Favicon = resolveMetaURL(base, "/favicon.ico")
+	}
+	return meta
+}
+
+// parseAttrs returns the attributes of an HTML tag, with lower-case names and
+// unescaped values.
+func parseAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+		value := m[2]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			value = value[1 : len(value)-1]
+		}
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(value)
+	}
+	return attrs
+}
+
+// cleanMetaText unescapes text, collapses whitespace and caps its length.
+func cleanMetaText(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if r := []rune(s); len(r) > metaFieldMaxRunes {
+		s = string(r[:metaFieldMaxRunes]) + "…"
+	}
+	return s
+}
+
+// resolveMetaURL resolves ref against base and keeps only http(s) results.
+func resolveMetaURL(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Plain &amp; simple</title>
+			<meta name="description" content="A page">
+			<meta property="og:title" content="Open Graph title">
+			<meta property="og:image" content="/cover.png">
+			<link rel="shortcut icon" href="/icon.png">
+		</head></html>`)
+	}))
+	defer srv.Close()
+
+	meta := newMetaFetcher(true).fetch(context.Background(), srv.URL+"/page")
+	if meta.Error != "" {
+		t.Fatalf("fetch failed: %s", meta.Error)
+	}
+	want := PageMeta{
+		Title:       "Open Graph title",
+		Description: "A page",
+		Favicon:     srv.URL + "/icon.png",
+		Image:       srv.URL + "/cover.png",
+	}
+	meta.FetchedAt = time.Time{}
+	if *meta != want {
+		t.Errorf("meta = %+v, want %+v", *meta, want)
+	}
+}
+
+func TestFetchMetadataRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	meta := newMetaFetcher(false).fetch(context.Background(), srv.URL)
+	if !strings.Contains(meta.Error, errPrivateAddress.Error()) {
+		t.Errorf("error = %q, want %q", meta.Error, errPrivateAddress)
+	}
+	if hit {
+		t.Error("the private server was reached")
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":              true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // cloud metadata
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"64:ff9b::a00:1":       false,
+		"255.255.255.255":      false,
+		"224.0.0.1":            false,
+		"::ffff:8.8.8.8":       true,
+		"198.18.0.1":           false,
+		"240.0.0.1":            false,
+		"192.0.0.8":            false,
+		"2001:4860:4860::8888": true,
+	}
+	for addr, want := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestFetchMetadataTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	f := newMetaFetcher(true)
+	if f.client.Timeout != metaFetchTimeout {
+		t.Errorf("client timeout = %v, want %v", f.client.Timeout, metaFetchTimeout)
+	}
+	f.client.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	meta := f.fetch(context.Background(), srv.URL)
+	if meta.Error == "" {
+		t.Fatal("fetch of a hanging page succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %v, want it cut off by the timeout", elapsed)
+	}
+}
+
+func TestFetchMetadataReadsOnlyTheHead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<meta name="description" content="early">`)
+		fmt.Fprint(w, strings.Repeat(" ", metaMaxBodyBytes))
+		fmt.Fprint(w, `<title>too late</title>`)
+	}))
+	defer srv.Close()
+
+	meta := newMetaFetcher(true).fetch(context.Background(), srv.URL)
+	if meta.Error != "" {
+		t.Fatalf("fetch failed: %s", meta.Error)
+	}
+	if meta.Description != "early" {
+		t.Errorf("description = %q, want early", meta.Description)
+	}
+	if meta.Title != "" {
+		t.Errorf("title = %q, want nothing past %d bytes", meta.Title, metaMaxBodyBytes)
+	}
+}
+
+func TestFetchMetadataCapsFieldLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<title>%s</title>", strings.Repeat("é", 2*metaFieldMaxRunes))
+	}))
+	defer srv.Close()
+
+	meta := newMetaFetcher(true).fetch(context.Background(), srv.URL)
+	if n := len([]rune(meta.Title)); n != metaFieldMaxRunes+1 {
+		t.Errorf("title has %d runes, want %d and an ellipsis", n, metaFieldMaxRunes)
+	}
+}
+
+func TestFetchMetadataFailures(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := map[string]string{
+		"/missing": "404 Not Found",
+		"/image":   "not an HTML page (image/png)",
+		"/loop":    fmt.Sprintf("stopped after %d redirects", metaMaxRedirects),
+	}
+	f := newMetaFetcher(true)
+	for path, want := range tests {
+		meta := f.fetch(context.Background(), srv.URL+path)
+		if !strings.Contains(meta.Error, want) {
+			t.Errorf("%s: error = %q, want %q", path, meta.Error, want)
+		}
+		if meta.FetchedAt.IsZero() {
+			t.Errorf("%s: failed fetch has no time", path)
+		}
+	}
+}
+
+func TestParsePageMetaURLs(t *testing.T) {
+	base, _ := url.Parse("https://example.com/a/page")
+	meta := parsePageMeta(`<meta property="og:image" content="javascript:alert(1)">`, base)
+	if meta.Image != "" {
+		t.Errorf("image = %q, want non-http URLs dropped", meta.Image)
+	}
+	if meta.Favicon != "https://example.com/favicon.ico" {
+		t.Errorf("favicon = %q, want the default /favicon.ico", meta.Favicon)
+	}
+
+	meta = parsePageMeta(`<link rel="icon" href="../icon.svg"><meta property='og:image' content='img/x.png'>`, base)
+	if meta.Favicon != "https://example.com/icon.svg" || meta.Image != "https://example.com/a/img/x.png" {
+		t.Errorf("favicon = %q, image = %q, want them resolved against the page", meta.Favicon, meta.Image)
+	}
+}
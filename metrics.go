@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestLabels labels a request counter.
+type requestLabels struct {
+	Handler string
+	Status  int
+}
+
+// histogram is a Prometheus-style cumulative histogram.
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Metrics collects request metrics for /metrics.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[requestLabels]uint64
+	latencies map[string]*histogram // handler -> latency
+	limited   map[string]uint64     // handler -> requests rejected by the rate limiter
+	started   time.Time
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  make(map[requestLabels]uint64),
+		latencies: make(map[string]*histogram),
+		limited:   make(map[string]uint64),
+		started:   time.Now(),
+	}
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Instrument counts the requests served by h and their latency under the
+// given handler name.
+func (m *Metrics) Instrument(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		elapsed := time.Since(start).Seconds()
+
+		m.mu.Lock()
+		m.requests[requestLabels{Handler: name, Status: rec.status}]++
+		hist, ok := m.latencies[name]
+		if !ok {
+			hist = &histogram{}
+			m.latencies[name] = hist
+		}
+		hist.observe(elapsed)
+		m.mu.Unlock()
+	}
+}
+
+// rateLimited counts a request the rate limiter turned away.
+func (m *Metrics) rateLimited(name string) {
+	m.mu.Lock()
+	m.limited[name]++
+	m.mu.Unlock()
+}
+
+// writeRequestMetrics writes the request counters and histograms.
+func (m *Metrics) writeRequestMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Handler != labels[j].Handler {
+			return labels[i].Handler < labels[j].Handler
+		}
+		return labels[i].Status < labels[j].Status
+	})
+	fmt.Fprintln(w, "# HELP shortener_http_requests_total HTTP requests by handler and status code.")
+	fmt.Fprintln(w, "# TYPE shortener_http_requests_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(w, "shortener_http_requests_total{handler=%q,code=\"%d\"} %d\n", l.Handler, l.Status, m.requests[l])
+	}
+
+	names := make([]string, 0, len(m.latencies))
+	for name := range m.latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "# HELP shortener_http_request_duration_seconds HTTP request latency by handler.")
+	fmt.Fprintln(w, "# TYPE shortener_http_request_duration_seconds histogram")
+	for _, name := range names {
+		hist := m.latencies[name]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "shortener_http_request_duration_seconds_bucket{handler=%q,le=%q} %d\n", name, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "shortener_http_request_duration_seconds_bucket{handler=%q,le=\"+Inf\"} %d\n", name, hist.count)
+		fmt.Fprintf(w, "shortener_http_request_duration_seconds_sum{handler=%q} %g\n", name, hist.sum)
+		fmt.Fprintf(w, "shortener_http_request_duration_seconds_count{handler=%q} %d\n", name, hist.count)
+	}
+
+	names = names[:0]
+	for name := range m.limited {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "# HELP shortener_rate_limited_total Requests rejected by the rate limiter, by handler.")
+	fmt.Fprintln(w, "# TYPE shortener_rate_limited_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "shortener_rate_limited_total{handler=%q} %d\n", name, m.limited[name])
+	}
+}
+
+// writeGauge writes a single unlabeled metric.
+func writeGauge(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// HandleMetrics serves the metrics in the Prometheus text format.
+func (us *URLShortener) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	us.mu.RLock()
+	links := len(us.store)
+	var views, fallbackHits uint64
+	var broken, disabled int
+	perDomain := make(map[string]int)
+	for key, data := range us.store {
+		views += data.ViewCount
+		fallbackHits += data.FallbackHits
+		if data.Health != nil && data.Health.Broken {
+			broken++
+		}
+		if data.Disabled {
+			disabled++
+		}
+		perDomain[key.Domain]++
+	}
+	fallbackHits += us.fallbackHits
+	for _, d := range us.domains {
+		fallbackHits += d.FallbackHits
+	}
+	workspaces := len(us.workspaces)
+	us.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if us.metrics != nil {
+		us.metrics.writeRequestMetrics(w)
+		writeGauge(w, "shortener_uptime_seconds", "gauge", "Seconds since the server started.", time.Since(us.metrics.started).Seconds())
+	}
+	writeGauge(w, "shortener_links", "gauge", "Links in the store.", float64(links))
+	fmt.Fprintln(w, "# HELP shortener_links_by_domain Links in the store by short domain.")
+	fmt.Fprintln(w, "# TYPE shortener_links_by_domain gauge")
+	domains := make([]string, 0, len(perDomain))
+	for d := range perDomain {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	for _, d := range domains {
+		label := d
+		if label == "" {
+			label = "default"
+		}
+		fmt.Fprintf(w, "shortener_links_by_domain{domain=%q} %d\n", label, perDomain[d])
+	}
+	writeGauge(w, "shortener_broken_links", "gauge", "Links whose destination is marked broken.", float64(broken))
+	writeGauge(w, "shortener_disabled_links", "gauge", "Links switched off by their owner.", float64(disabled))
+	writeGauge(w, "shortener_workspaces", "gauge", "Workspaces.", float64(workspaces))
+	writeGauge(w, "shortener_views", "gauge", "Views recorded on the links in the store.", float64(views))
+	writeGauge(w, "shortener_fallback_hits", "gauge", "Visitors sent to a fallback URL by the links and domains in the store.", float64(fallbackHits))
+	if us.meta != nil {
+		writeGauge(w, "shortener_metadata_queue_length", "gauge", "Links waiting for a metadata fetch.", float64(len(us.meta.jobs)))
+	}
+	writeGauge(w, "shortener_webhook_queue_length", "gauge", "Webhook deliveries waiting to be sent.", float64(len(us.webhooks.queue)))
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification kinds.
+const (
+	NotifyMilestone = "milestone"
+	NotifyAnomaly   = "anomaly"
+)
+
+const (
+	notifyQueueSize = 1000
+	notifyTimeout   = 10 * time.Second
+
+	// The anomaly detector keeps an exponentially weighted moving average
+	// of clicks per minute. A minute counts as a spike when it reaches
+	// SpikeFactor times that average, or times anomalyMinBaseline for links
+	// with little traffic so far.
+	anomalyAlpha       = 0.1
+	anomalyMinBaseline = 1.0
+	anomalyCooldown    = time.Hour
+)
+
+// Notification tells people about something unusual or notable in a link's
+// traffic.
+type Notification struct {
+	Kind     string      `json:"kind"`
+	Message  string      `json:"message"`
+	Link     webhookLink `json:"link"`
+	Clicks   uint64      `json:"clicks"`             // total clicks so far
+	Rate     int         `json:"rate,omitempty"`     // clicks in the spiking minute
+	Baseline float64     `json:"baseline,omitempty"` // usual clicks per minute
+	At       time.Time   `json:"at"`
+}
+
+// Notifier delivers notifications somewhere.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotifyRule sets when a link's traffic triggers notifications. Links
+// without one use the server defaults.
+type NotifyRule struct {
+	Milestones  []uint64 `json:"milestones,omitempty"`   // click totals to announce
+	SpikeFactor float64  `json:"spike_factor,omitempty"` // multiple of normal traffic that counts as a spike
+	Off         bool     `json:"off,omitempty"`          // no notifications for this link
+}
+
+func (rule *NotifyRule) validate() error {
+	if rule.SpikeFactor < 0 {
+		return fmt.Errorf("spike_factor must not be negative")
+	}
+	return nil
+}
+
+// clickRate is the anomaly detector's state for one link.
+type clickRate struct {
+	minute    int64   // current minute, in Unix minutes
+	count     int     // clicks in the current minute
+	avg       float64 // moving average of clicks per completed minute
+	lastAlert time.Time
+}
+
+// add counts a click at now and reports whether the current minute has
+// become a spike.
+func (c *clickRate) add(now time.Time, factor float64) bool {
+	minute := now.Unix() / 60
+	if minute != c.minute {
+		if c.minute != 0 {
+			c.avg = anomalyAlpha*float64(c.count) + (1-anomalyAlpha)*c.avg
+			// Minutes without clicks pull the average down too.
+			if gap := minute - c.minute - 1; gap > 0 {
+				c.avg *= math.Pow(1-anomalyAlpha, float64(gap))
+			}
+		}
+		c.minute, c.count = minute, 0
+	}
+	c.count++
+	baseline := math.Max(c.avg, anomalyMinBaseline)
+	if factor <= 0 || float64(c.count) < factor*baseline || now.Sub(c.lastAlert) < anomalyCooldown {
+		return false
+	}
+	c.lastAlert = now
+	return true
+}
+
+// notifyCenter fans notifications out to the configured notifiers in the
+// background.
+type notifyCenter struct {
+	notifiers   []Notifier
+	milestones  []uint64 // default milestones
+	spikeFactor float64  // default spike factor, 0 disables anomaly alerts
+	recent      *MemoryNotifier
+	queue       chan Notification
+}
+
+// StartNotifications starts delivering notifications to the given notifiers.
+// The latest ones are also kept for /admin/notifications.
+func (us *URLShortener) StartNotifications(notifiers []Notifier, milestones []uint64, spikeFactor float64) {
+	recent := &MemoryNotifier{Max: 100}
+	nc := &notifyCenter{
+		notifiers:   append([]Notifier{recent}, notifiers...),
+		milestones:  milestones,
+		spikeFactor: spikeFactor,
+		recent:      recent,
+		queue:       make(chan Notification, notifyQueueSize),
+	}
+	us.notify = nc
+	go func() {
+		for n := range nc.queue {
+			for _, notifier := range nc.notifiers {
+				ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+				if err := notifier.Notify(ctx, n); err != nil {
+					slog.Warn("Notification failed", "message", n.Message, "err", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// clickAlerts updates the anomaly detector for a counted click and returns
+// any notifications it triggers. The caller must hold us.mu for writing.
+func (us *URLShortener) clickAlerts(key linkKey, data *URLData, now time.Time) []Notification {
+	nc := us.notify
+	if nc == nil || (data.Notify != nil && data.Notify.Off) {
+		return nil
+	}
+	milestones, factor := nc.milestones, nc.spikeFactor
+	if data.Notify != nil {
+		if data.Notify.Milestones != nil {
+			milestones = data.Notify.Milestones
+		}
+		if data.Notify.SpikeFactor > 0 {
+			factor = data.Notify.SpikeFactor
+		}
+	}
+
+	var alerts []Notification
+	link := us.webhookLink(key, data)
+	for _, m := range milestones {
+		if data.ViewCount == m {
+			alerts = append(alerts, Notification{
+				Kind:    NotifyMilestone,
+				Message: fmt.Sprintf("%s passed %d clicks", link.ShortURL, m),
+				Link:    link,
+				Clicks:  data.ViewCount,
+				At:      now,
+			})
+		}
+	}
+
+	rate, ok := us.clickRates[key]
+	if !ok {
+		rate = &clickRate{}
+		us.clickRates[key] = rate
+	}
+	if rate.add(now, factor) {
+		baseline := math.Max(rate.avg, anomalyMinBaseline)
+		alerts = append(alerts, Notification{
+			Kind:     NotifyAnomaly,
+			Message:  fmt.Sprintf("%s got %d clicks in a minute, %.0fx its usual %.1f", link.ShortURL, rate.count, float64(rate.count)/baseline, rate.avg),
+			Link:     link,
+			Clicks:   data.ViewCount,
+			Rate:     rate.count,
+			Baseline: rate.avg,
+			At:       now,
+		})
+	}
+	return alerts
+}
+
+// sendNotifications queues notifications without blocking.
+func (us *URLShortener) sendNotifications(alerts []Notification) {
+	for _, n := range alerts {
+		select {
+		case us.notify.queue <- n:
+		default:
+			slog.Warn("Notification queue full, dropping notification", "message", n.Message)
+		}
+	}
+}
+
+// WebhookNotifier posts notifications as JSON to a URL, such as a chat
+// incoming webhook.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(struct {
+		Notification
+		Text string `json:"text"` // understood by Slack-style webhooks
+	}{n, n.Message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := wn.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier emails notifications.
+type SMTPNotifier struct {
+	Addr     string // host:port
+	From     string
+	To       []string
+	Username string // optional, enables PLAIN auth
+	Password string
+}
+
+func (sn *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if sn.Username != "" {
+		host, _, _ := strings.Cut(sn.Addr, ":")
+		auth = smtp.PlainAuth("", sn.Username, sn.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [url-shortner] %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n\r\nShort URL: %s\r\nDestination: %s\r\nTotal clicks: %d\r\n",
+		sn.From, strings.Join(sn.To, ", "), n.Message, n.Message, n.Link.ShortURL, n.Link.LongURL, n.Clicks)
+	// net/smtp has no context support; run it aside so ctx still bounds
+	// the wait.
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(sn.Addr, auth, sn.From, sn.To, []byte(msg)) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogNotifier writes notifications to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	slog.InfoContext(ctx, "Notification", "kind", n.Kind, "message", n.Message, "short_url", n.Link.ShortURL)
+	return nil
+}
+
+// MemoryNotifier keeps the latest notifications in memory, for
+// /admin/notifications and as a stand-in for real notifiers in local
+// testing.
+type MemoryNotifier struct {
+	Max  int // how many to keep, 0 for all
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (mn *MemoryNotifier) Notify(_ context.Context, n Notification) error {
+	mn.mu.Lock()
+	mn.sent = append(mn.sent, n)
+	if mn.Max > 0 && len(mn.sent) > mn.Max {
+		mn.sent = mn.sent[len(mn.sent)-mn.Max:]
+	}
+	mn.mu.Unlock()
+	return nil
+}
+
+// Sent returns the notifications received so far.
+func (mn *MemoryNotifier) Sent() []Notification {
+	mn.mu.Lock()
+	defer mn.mu.Unlock()
+	return append([]Notification(nil), mn.sent...)
+}
+
+// HandleNotifications lists recent notifications, newest first.
+func (us *URLShortener) HandleNotifications(w http.ResponseWriter, r *http.Request) {
+	if !us.requireAdmin(w, r) {
+		return
+	}
+	sent := []Notification{}
+	if us.notify != nil {
+		recent := us.notify.recent.Sent()
+		for i := len(recent) - 1; i >= 0; i-- {
+			sent = append(sent, recent[i])
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sent)
+}
+
+// parseMilestones reads a comma-separated list of click totals.
+func parseMilestones(s string) ([]uint64, error) {
+	var milestones []uint64
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		m, err := strconv.ParseUint(f, 10, 64)
+		if err != nil || m == 0 {
+			return nil, fmt.Errorf("invalid milestone %q", f)
+		}
+		milestones = append(milestones, m)
+	}
+	return milestones, nil
+}
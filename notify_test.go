@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClickRateNewLink(t *testing.T) {
+	// With no history the baseline is anomalyMinBaseline, so the 5th click
+	// in a minute is a spike at factor 5.
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var c clickRate
+	for i := 1; i <= 4; i++ {
+		if c.add(start.Add(time.Duration(i)*time.Second), 5) {
+			t.Fatalf("click %d alerted below the threshold", i)
+		}
+	}
+	if !c.add(start.Add(5*time.Second), 5) {
+		t.Fatal("5th click did not alert")
+	}
+	if c.add(start.Add(6*time.Second), 5) {
+		t.Error("alerted again within the cooldown")
+	}
+}
+
+func TestClickRateFollowsAverage(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var c clickRate
+	minute := func(m int) time.Time { return start.Add(time.Duration(m) * time.Minute) }
+
+	// Steady traffic of 10 clicks a minute builds up the average.
+	want := 0.0
+	for m := 0; m < 60; m++ {
+		for i := 0; i < 10; i++ {
+			if c.add(minute(m), 20) {
+				t.Fatalf("steady traffic alerted in minute %d", m)
+			}
+		}
+		if m > 0 {
+			want = anomalyAlpha*10 + (1-anomalyAlpha)*want
+		}
+	}
+	if math.Abs(c.avg-want) > 1e-9 {
+		t.Fatalf("average = %v, want %v", c.avg, want)
+	}
+
+	// The next minute completes the average; the spike needs factor times
+	// that many clicks.
+	next := minute(60)
+	c.add(next, 3)
+	avg := anomalyAlpha*10 + (1-anomalyAlpha)*want
+	threshold := int(math.Ceil(3 * avg))
+	for i := 2; i < threshold; i++ {
+		if c.add(next, 3) {
+			t.Fatalf("alerted at %d clicks, threshold is %d", i, threshold)
+		}
+	}
+	if !c.add(next, 3) {
+		t.Fatalf("no alert at %d clicks", threshold)
+	}
+	if c.add(next.Add(anomalyCooldown-time.Second), 3) {
+		t.Error("alerted again within the cooldown")
+	}
+}
+
+func TestClickRateDecaysOverQuietMinutes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := clickRate{minute: start.Unix() / 60, count: 10, avg: 10}
+
+	// Ten quiet minutes, then a click: the completed minute is folded in
+	// and each empty minute decays the average once.
+	c.add(start.Add(11*time.Minute), 0)
+	want := (anomalyAlpha*10 + (1-anomalyAlpha)*10) * math.Pow(1-anomalyAlpha, 10)
+	if math.Abs(c.avg-want) > 1e-9 {
+		t.Errorf("average = %v, want %v", c.avg, want)
+	}
+	if c.count != 1 {
+		t.Errorf("count = %d, want the new minute's 1", c.count)
+	}
+}
+
+func TestClickRateDisabled(t *testing.T) {
+	var c clickRate
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		if c.add(now, 0) {
+			t.Fatal("alerted with a zero spike factor")
+		}
+	}
+}
+
+// newNotifyShortener returns a shortener with one link, code "abc", whose
+// notifications go to the returned MemoryNotifier.
+func newNotifyShortener(t *testing.T, milestones []uint64, spikeFactor float64, rule *NotifyRule) (*URLShortener, *MemoryNotifier) {
+	t.Helper()
+	us := NewURLShortener("https://sho.rt")
+	mem := &MemoryNotifier{}
+	us.StartNotifications([]Notifier{mem}, milestones, spikeFactor)
+	us.mu.Lock()
+	us.insertLink(linkKey{Code: "abc"}, linkRecord{LongURL: "https://example.com", Notify: rule}.toURLData(), UserInfo{CreatedAt: time.Now()})
+	us.mu.Unlock()
+	return us, mem
+}
+
+func click(us *URLShortener, n int) {
+	for i := 0; i < n; i++ {
+		us.HandleRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+	}
+}
+
+// waitSent waits for the notifier to have received n notifications.
+func waitSent(t *testing.T, mem *MemoryNotifier, n int) []Notification {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sent := mem.Sent()
+		if len(sent) >= n || time.Now().After(deadline) {
+			return sent
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClickNotifications(t *testing.T) {
+	us, mem := newNotifyShortener(t, []uint64{3}, 0, nil)
+	click(us, 4)
+
+	sent := waitSent(t, mem, 1)
+	if len(sent) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(sent))
+	}
+	n := sent[0]
+	if n.Kind != NotifyMilestone || n.Clicks != 3 || n.Link.ShortURL != "https://sho.rt/abc" {
+		t.Errorf("notification = %+v", n)
+	}
+	if n.Message != "https://sho.rt/abc passed 3 clicks" {
+		t.Errorf("message = %q", n.Message)
+	}
+}
+
+func TestClickNotificationsSpike(t *testing.T) {
+	us, mem := newNotifyShortener(t, nil, 5, nil)
+	click(us, 5)
+
+	sent := waitSent(t, mem, 1)
+	if len(sent) != 1 || sent[0].Kind != NotifyAnomaly || sent[0].Rate != 5 {
+		t.Fatalf("notifications = %+v, want one anomaly at 5 clicks", sent)
+	}
+}
+
+func TestClickNotificationsLinkRule(t *testing.T) {
+	us, mem := newNotifyShortener(t, []uint64{1}, 5, &NotifyRule{Milestones: []uint64{2}, SpikeFactor: 100})
+	click(us, 5)
+	if sent := waitSent(t, mem, 1); len(sent) != 1 || sent[0].Clicks != 2 {
+		t.Fatalf("notifications = %+v, want only the link's milestone", sent)
+	}
+
+	us, mem = newNotifyShortener(t, []uint64{1}, 1, &NotifyRule{Off: true})
+	click(us, 5)
+	time.Sleep(50 * time.Millisecond)
+	if sent := mem.Sent(); len(sent) != 0 {
+		t.Errorf("notifications = %+v for a link with notifications off", sent)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	n := Notification{Kind: NotifyMilestone, Message: "passed 100 clicks", Clicks: 100, Link: webhookLink{Code: "abc"}}
+	if err := (&WebhookNotifier{URL: srv.URL}).Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "passed 100 clicks" || got["kind"] != NotifyMilestone || got["clicks"] != 100.0 {
+		t.Errorf("payload = %v", got)
+	}
+	if link, _ := got["link"].(map[string]any); link["code"] != "abc" {
+		t.Errorf("payload link = %v", got["link"])
+	}
+}
+
+func TestWebhookNotifierFailures(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	err := (&WebhookNotifier{URL: srv.URL}).Notify(context.Background(), Notification{})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("error = %v, want the 500 status", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := (&WebhookNotifier{URL: srv.URL + "/slow"}).Notify(ctx, Notification{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline", err)
+	}
+}
+
+// fakeSMTP accepts one mail session on a local port and sends the message
+// it received on the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		var envelope []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+				envelope = append(envelope, line)
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var body strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				reply("250 queued")
+				messages <- strings.Join(envelope, "\n") + "\n\n" + body.String()
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	sn := &SMTPNotifier{Addr: addr, From: "alerts@sho.rt", To: []string{"a@example.com", "b@example.com"}}
+	n := Notification{
+		Kind:    NotifyAnomaly,
+		Message: "https://sho.rt/abc got 50 clicks in a minute",
+		Link:    webhookLink{ShortURL: "https://sho.rt/abc", LongURL: "https://example.com"},
+		Clicks:  1234,
+	}
+	if err := sn.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg string
+	select {
+	case msg = <-messages:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	for _, want := range []string{
+		"MAIL FROM:<alerts@sho.rt>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: [url-shortner] https://sho.rt/abc got 50 clicks in a minute\r\n",
+		"Short URL: https://sho.rt/abc\r\n",
+		"Destination: https://example.com\r\n",
+		"Total clicks: 1234\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// A server that accepts but never greets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sn := &SMTPNotifier{Addr: ln.Addr().String(), From: "alerts@sho.rt", To: []string{"a@example.com"}}
+	if err := sn.Notify(ctx, Notification{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline", err)
+	}
+}
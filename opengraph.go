@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OpenGraph overrides the preview that chat and social apps show for a
+// link. Empty fields fall back to the destination page's metadata.
+type OpenGraph struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// validate trims the fields and checks that the image is an http(s) URL.
+func (og *OpenGraph) validate() error {
+	og.Title = strings.TrimSpace(og.Title)
+	og.Description = strings.TrimSpace(og.Description)
+	og.Image = strings.TrimSpace(og.Image)
+	if og.Image != "" {
+		u, err := url.Parse(og.Image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid og image URL %q", og.Image)
+		}
+	}
+	return nil
+}
+
+// empty reports whether no override is set.
+func (og *OpenGraph) empty() bool {
+	return og == nil || (og.Title == "" && og.Description == "" && og.Image == "")
+}
+
+// crawlerAgents are user agent fragments of link unfurlers. They are given a
+// page of Open Graph tags instead of a redirect. Search engine crawlers are
+// left out on purpose so that they keep seeing the redirect.
+var crawlerAgents = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"slack-imgproxy",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"skypeuripreview",
+	"microsoftpreview",
+	"pinterest",
+	"redditbot",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"mastodon",
+	"cardyb",
+}
+
+// isCrawler reports whether a user agent belongs to a link unfurler.
+func isCrawler(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, agent := range crawlerAgents {
+		if strings.Contains(ua, agent) {
+			return true
+		}
+	}
+	return false
+}
+
+// socialCard is the data for the page served to crawlers.
+type socialCard struct {
+	ShortURL    string
+	LongURL     string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// socialCard builds a link's card from its overrides, falling back to its
+// title and destination metadata. The caller must hold us.mu.
+func (us *URLShortener) socialCard(key linkKey, data *URLData) *socialCard {
+	card := &socialCard{ShortURL: us.shortURL(key), LongURL: data.LongURL, Title: data.displayTitle(), SiteName: us.brandingFor(key.Domain).SiteName}
+	if data.Meta != nil {
+		card.Description = data.Meta.Description
+		card.Image = data.Meta.Image
+	}
+	if og := data.OpenGraph; og != nil {
+		if og.Title != "" {
+			card.Title = og.Title
+		}
+		if og.Description != "" {
+			card.Description = og.Description
+		}
+		if og.Image != "" {
+			card.Image = og.Image
+		}
+	}
+	if card.Title == "" {
+		card.Title = data.LongURL
+	}
+	return card
+}
+
+// serveSocialCard writes the Open Graph page for a crawler.
+func (us *URLShortener) serveSocialCard(w http.ResponseWriter, card *socialCard) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := us.template("card.html").Execute(w, card); err != nil {
+		slog.Error("Template execution failed", "template", "social card", "err", err)
+	}
+}
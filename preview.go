@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PreviewData is shown on the preview page.
+type PreviewData struct {
+	ShortURL string
+	LongURL  string
+	Title    string
+	Meta     *PageMeta
+	Expired  bool
+	Brand    Branding
+	Locale   *Locale
+}
+
+// HandlePreview serves /preview/{code}: the link's destination and page
+// metadata, so visitors can see where a link goes before following it.
+// Visiting the preview does not count as a view.
+func (us *URLShortener) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/preview/")
+	if code == "" {
+		http.Error(w, "Short code not provided", http.StatusBadRequest)
+		return
+	}
+	key := linkKey{Domain: us.requestNamespace(r), Code: code}
+
+	us.mu.RLock()
+	data, exists := us.store[key]
+	if !exists {
+		us.mu.RUnlock()
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	if !us.canView(r, data) {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	preview := PreviewData{
+		ShortURL: us.shortURL(key),
+		LongURL:  data.LongURL,
+		Title:    data.displayTitle(),
+		Meta:     data.Meta,
+		Expired:  data.expired(),
+		Brand:    us.brandingFor(us.namespace(r.Host)),
+	}
+	us.mu.RUnlock()
+	preview.Locale = localeFor(w, r)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := us.template("preview.html").Execute(w, preview); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
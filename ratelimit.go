@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweep is how many clients the limiter tracks before it forgets
+// the ones whose allowance has refilled.
+const rateLimitSweep = 10000
+
+// bucket is one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter lets each client make up to perMinute requests at once, and
+// refills that allowance evenly over a minute.
+type rateLimiter struct {
+	mu      sync.Mutex
+	burst   float64
+	rate    float64 // tokens per second
+	clients map[string]*bucket
+	now     func() time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		burst:   float64(perMinute),
+		rate:    float64(perMinute) / 60,
+		clients: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from client's bucket. When it is empty it returns
+// false and how long until the next token.
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.clients[client]
+	if !ok {
+		if len(rl.clients) >= rateLimitSweep {
+			rl.sweep(now)
+		}
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.clients[client] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose bucket would be full by now, since a new
+// bucket starts full anyway.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for client, b := range rl.clients {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.clients, client)
+		}
+	}
+}
+
+// rateLimit rejects requests to h from clients over RATE_LIMIT with 429
+// Too Many Requests, counting them under the handler name for /metrics.
+func (us *URLShortener) rateLimit(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if us.limiter == nil {
+			h(w, r)
+			return
+		}
+		if ok, wait := us.limiter.allow(us.clientIP(r)); !ok {
+			if us.metrics != nil {
+				us.metrics.rateLimited(name)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
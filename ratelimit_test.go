@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, time.August, 3, 14, 0, 0, 0, time.UTC)
+	rl := newRateLimiter(2)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow("a"); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := rl.allow("a")
+	if ok {
+		t.Fatal("request over the burst was allowed")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("wait = %v, want 30s for 2 a minute", wait)
+	}
+	if ok, _ := rl.allow("b"); !ok {
+		t.Error("another client was refused")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _ := rl.allow("a"); !ok {
+		t.Error("request after the refill was refused")
+	}
+	if ok, _ := rl.allow("a"); ok {
+		t.Error("refill gave more than one token")
+	}
+
+	now = now.Add(time.Hour)
+	rl.sweep(now)
+	if len(rl.clients) != 0 {
+		t.Errorf("sweep kept %d refilled clients", len(rl.clients))
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	us := NewURLShortener("http://localhost")
+	us.limiter = newRateLimiter(1)
+	h := us.metrics.Instrument("shorten", us.rateLimit("shorten", func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/shorten", nil))
+		if w.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	us.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`shortener_rate_limited_total{handler="shorten"} 1`,
+		`shortener_http_requests_total{handler="shorten",code="429"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
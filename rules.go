@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedirectRule sends visitors that match every one of its criteria to URL
+// instead of the link's LongURL. Empty criteria match anything, and a link's
+// rules are evaluated in order with the first match winning.
+type RedirectRule struct {
+	Name     string      `json:"name,omitempty"`
+	URL      string      `json:"url"`
+	OS       []string    `json:"os,omitempty"`
+	Device   []string    `json:"device,omitempty"`
+	Browser  []string    `json:"browser,omitempty"`
+	Language []string    `json:"language,omitempty"`
+	Country  []string    `json:"country,omitempty"`
+	Window   *TimeWindow `json:"window,omitempty"`
+}
+
+// TimeWindow restricts a rule to a period of time. Start and End bound the
+// absolute range, while Days and From/To ("15:04") limit it to certain days
+// of the week and hours of the day in the given time zone.
+type TimeWindow struct {
+	Start    time.Time `json:"start,omitempty"`
+	End      time.Time `json:"end,omitempty"`
+	Days     []string  `json:"days,omitempty"`
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to,omitempty"`
+	TimeZone string    `json:"timezone,omitempty"`
+}
+
+// RuleHit is a single row of the rule breakdown on the stats page.
+type RuleHit struct {
+	Name string
+	URL  string
+	Hits uint64
+}
+
+// defaultRuleName is the RuleHits key for visits that matched no rule.
+const defaultRuleName = "default"
+
+// visitor describes the request attributes redirect rules can match on.
+type visitor struct {
+	Browser   string
+	OS        string
+	Device    string
+	Languages []string
+	Country   string
+	Time      time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// newVisitor collects everything the rules need from the request.
+func (us *URLShortener) newVisitor(r *http.Request) visitor {
+	browser, os, device := parseUserAgent(r.UserAgent())
+	v := visitor{
+		Browser:   browser,
+		OS:        os,
+		Device:    device,
+		Languages: parseAcceptLanguage(r.Header.Get("Accept-Language")),
+		Time:      time.Now(),
+	}
+	if us.geo != nil {
+		v.Country = us.geo.Country(us.clientIP(r))
+	}
+	return v
+}
+
+// label returns the name used for the rule in stats.
+func (rule RedirectRule) label(i int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("rule %d", i+1)
+}
+
+// matches reports whether the visitor satisfies every criterion of the rule.
+func (rule RedirectRule) matches(v visitor) bool {
+	if !matchesAny(rule.OS, v.OS) || !matchesAny(rule.Device, v.Device) || !matchesAny(rule.Browser, v.Browser) {
+		return false
+	}
+	if !matchesAny(rule.Country, v.Country) {
+		return false
+	}
+	if len(rule.Language) > 0 && !matchesLanguage(rule.Language, v.Languages) {
+		return false
+	}
+	if rule.Window != nil && !rule.Window.contains(v.Time) {
+		return false
+	}
+	return true
+}
+
+// matchRule returns the index of the first rule that matches, or -1.
+func matchRule(rules []RedirectRule, v visitor) int {
+	for i, rule := range rules {
+		if rule.matches(v) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLanguage matches on primary subtags too, so a rule for "en" matches
+// a visitor asking for "en-GB".
+func matchesLanguage(allowed, languages []string) bool {
+	for _, lang := range languages {
+		for _, a := range allowed {
+			a = strings.ToLower(a)
+			if lang == a || strings.HasPrefix(lang, a+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseAcceptLanguage returns the lower-cased language tags from an
+// Accept-Language header, most preferred first.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.tag
+	}
+	return langs
+}
+
+// contains reports whether t falls inside the window.
+func (w *TimeWindow) contains(t time.Time) bool {
+	if !w.Start.IsZero() && t.Before(w.Start) {
+		return false
+	}
+	if !w.End.IsZero() && !t.Before(w.End) {
+		return false
+	}
+	if w.TimeZone != "" {
+		if loc, err := time.LoadLocation(w.TimeZone); err == nil {
+			t = t.In(loc)
+		}
+	}
+	if len(w.Days) > 0 {
+		found := false
+		for _, d := range w.Days {
+			if weekdays[strings.ToLower(d)[:3]] == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if w.From != "" || w.To != "" {
+		from, _ := parseClock(w.From)
+		to, _ := parseClock(w.To)
+		if w.To == "" {
+			to = 24 * 60
+		}
+		now := t.Hour()*60 + t.Minute()
+		if from <= to {
+			return now >= from && now < to
+		}
+		// Windows such as 22:00-06:00 wrap around midnight.
+		return now >= from || now < to
+	}
+	return true
+}
+
+// parseClock turns "15:04" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateRules checks rules supplied by a client before they are stored.
+func validateRules(rules []RedirectRule) error {
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.URL == "" {
+			return fmt.Errorf("%s: url is required", rule.label(i))
+		}
+		if name := rule.label(i); name == defaultRuleName || seen[name] {
+			return fmt.Errorf("rule name %q is reserved or already used", name)
+		}
+		seen[rule.label(i)] = true
+		if rule.Window == nil {
+			continue
+		}
+		w := rule.Window
+		for _, d := range w.Days {
+			if len(d) < 3 {
+				return fmt.Errorf("%s: invalid day %q", rule.label(i), d)
+			}
+			if _, ok := weekdays[strings.ToLower(d)[:3]]; !ok {
+				return fmt.Errorf("%s: invalid day %q", rule.label(i), d)
+			}
+		}
+		if _, err := parseClock(w.From); err != nil {
+			return fmt.Errorf("%s: %v", rule.label(i), err)
+		}
+		if _, err := parseClock(w.To); err != nil {
+			return fmt.Errorf("%s: %v", rule.label(i), err)
+		}
+		if w.TimeZone != "" {
+			if _, err := time.LoadLocation(w.TimeZone); err != nil {
+				return fmt.Errorf("%s: unknown timezone %q", rule.label(i), w.TimeZone)
+			}
+		}
+		if !w.Start.IsZero() && !w.End.IsZero() && !w.End.After(w.Start) {
+			return errors.New(rule.label(i) + ": window end must be after start")
+		}
+	}
+	return nil
+}
+
+// ruleHits builds the per-rule breakdown shown on the stats page.
+func ruleHits(data *URLData) []RuleHit {
+	if len(data.Rules) == 0 {
+		return nil
+	}
+	hits := make([]RuleHit, 0, len(data.Rules)+1)
+	for i, rule := range data.Rules {
+		name := rule.label(i)
+		hits = append(hits, RuleHit{Name: name, URL: rule.URL, Hits: data.RuleHits[name]})
+	}
+	hits = append(hits, RuleHit{Name: defaultRuleName, URL: data.LongURL, Hits: data.RuleHits[defaultRuleName]})
+	return hits
+}
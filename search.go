@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	searchPageSize    = 20
+	maxSearchPageSize = 100
+)
+
+// searchIndex is an in-memory inverted index from terms to links. Terms are
+// kept sorted so that a query term can match every indexed term it prefixes.
+// It is guarded by URLShortener.mu.
+type searchIndex struct {
+	postings map[string]map[linkKey]bool // term -> links containing it
+	terms    []string                    // sorted keys of postings
+	docs     map[linkKey][]string        // link -> its terms, for removal
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[linkKey]bool),
+		docs:     make(map[linkKey][]string),
+	}
+}
+
+// searchTerms splits text into lower-case alphanumeric terms.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// linkTerms returns the distinct terms a link is found by: its code, the
+// words of its long URL and title (its own or its page's), and its tags.
+func linkTerms(key linkKey, data *URLData) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(words ...string) {
+		for _, w := range words {
+			if w != "" && !seen[w] {
+				seen[w] = true
+				terms = append(terms, w)
+			}
+		}
+	}
+	add(strings.ToLower(key.Code))
+	add(searchTerms(key.Code)...)
+	add(searchTerms(data.LongURL)...)
+	add(searchTerms(data.displayTitle())...)
+	for _, tag := range data.Tags {
+		add(tag)
+		add(searchTerms(tag)...)
+	}
+	return terms
+}
+
+// add indexes a link, replacing any previous entry for it.
+func (idx *searchIndex) add(key linkKey, data *URLData) {
+	idx.remove(key)
+	terms := linkTerms(key, data)
+	for _, term := range terms {
+		links, ok := idx.postings[term]
+		if !ok {
+			links = make(map[linkKey]bool)
+			idx.postings[term] = links
+			i := sort.SearchStrings(idx.terms, term)
+			idx.terms = append(idx.terms, "")
+			copy(idx.terms[i+1:], idx.terms[i:])
+			idx.terms[i] = term
+		}
+		links[key] = true
+	}
+	idx.docs[key] = terms
+}
+
+// remove drops a link from the index.
+func (idx *searchIndex) remove(key linkKey) {
+	for _, term := range idx.docs[key] {
+		links := idx.postings[term]
+		delete(links, key)
+		if len(links) == 0 {
+			delete(idx.postings, term)
+			i := sort.SearchStrings(idx.terms, term)
+			idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+		}
+	}
+	delete(idx.docs, key)
+}
+
+// search returns a score for every link matching all words of the query.
+// A word matches the terms it equals or prefixes; exact matches score higher.
+func (idx *searchIndex) search(query string) map[linkKey]int {
+	var scores map[linkKey]int
+	for _, word := range searchTerms(query) {
+		matched := make(map[linkKey]int)
+		for i := sort.SearchStrings(idx.terms, word); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], word); i++ {
+			weight := 1
+			if idx.terms[i] == word {
+				weight = 2
+			}
+			for key := range idx.postings[idx.terms[i]] {
+				if weight > matched[key] {
+					matched[key] = weight
+				}
+			}
+		}
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for key, score := range scores {
+			if w, ok := matched[key]; ok {
+				scores[key] = score + w
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+	return scores
+}
+
+// searchLinks returns the links in urls that match query, ordered by
+// relevance, then newest first. The caller must hold us.mu.
+func (us *URLShortener) searchLinks(urls []URLCreation, query string) []URLCreation {
+	scores := us.index.search(query)
+	var hits []URLCreation
+	for _, u := range urls {
+		if _, ok := scores[linkKey{Domain: u.Domain, Code: u.ShortCode}]; ok {
+			hits = append(hits, u)
+		}
+	}
+	score := func(u URLCreation) int { return scores[linkKey{Domain: u.Domain, Code: u.ShortCode}] }
+	sort.SliceStable(hits, func(i, j int) bool {
+		if si, sj := score(hits[i]), score(hits[j]); si != sj {
+			return si > sj
+		}
+		return hits[i].CreatedAt.After(hits[j].CreatedAt)
+	})
+	return hits
+}
+
+// searchResponse is a page of search results.
+type searchResponse struct {
+	Query   string        `json:"query"`
+	Total   int           `json:"total"`
+	Page    int           `json:"page"`
+	PerPage int           `json:"per_page"`
+	Results []linkSummary `json:"results"`
+}
+
+// HandleSearch serves GET /api/search?q=. It searches the links the requester
+// may list (see visibleLinks), so it accepts the same ?workspace=, ?tag= and
+// ?folder= parameters, and pages with ?page= and ?per_page=. Results are
+// ordered by relevance, then newest first.
+func (us *URLShortener) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if len(searchTerms(query)) == 0 {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage < 1 || perPage > maxSearchPageSize {
+		perPage = searchPageSize
+	}
+
+	us.mu.RLock()
+	urls, _, ok := us.visibleLinks(r, newLinkFilter(r))
+	if !ok {
+		us.mu.RUnlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	hits := us.searchLinks(urls, query)
+
+	resp := searchResponse{Query: query, Total: len(hits), Page: page, PerPage: perPage, Results: []linkSummary{}}
+	start := (page - 1) * perPage
+	for i := start; i < len(hits) && i < start+perPage; i++ {
+		key := linkKey{Domain: hits[i].Domain, Code: hits[i].ShortCode}
+		resp.Results = append(resp.Results, us.summarize(key, hits[i], us.store[key]))
+	}
+	us.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverConfig holds the HTTP server's timeouts and limits.
+type serverConfig struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration // whole request, including the body
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration // keep-alive connections
+	ShutdownTimeout   time.Duration // how long to drain in-flight requests
+	MaxHeaderBytes    int
+}
+
+var defaultServerConfig = serverConfig{
+	ReadHeaderTimeout: 5 * time.Second,
+	ReadTimeout:       60 * time.Second,
+	WriteTimeout:      60 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+	MaxHeaderBytes:    64 << 10,
+}
+
+// newServer returns a server for h on addr with the configured limits.
+func (c serverConfig) newServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+// serve runs the servers until ctx is done, then stops accepting
+// connections and waits up to ShutdownTimeout for in-flight requests to
+// finish. It returns early if a server fails.
+func (c serverConfig) serve(ctx context.Context, servers ...*http.Server) error {
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("%s: %w", srv.Addr, err)
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, draining requests", "timeout", c.ShutdownTimeout.String())
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("Server did not shut down cleanly", "addr", srv.Addr, "err", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotStatus is the outcome of the latest periodic or shutdown save.
+type snapshotStatus struct {
+	mu    sync.Mutex
+	path  string
+	saved time.Time // last successful save
+	err   error     // error of the last save, nil if it succeeded
+}
+
+// LoadSnapshot restores the domains, workspaces, webhooks and links saved
+// by SaveSnapshot. Domains listed in DOMAINS keep the root redirect
+// configured there; everything else comes from the snapshot. A
+// missing file is not an error, so a new server can start from an empty
+// store.
+func (us *URLShortener) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	file, err := readExport(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(file.Errors) > 0 {
+		return fmt.Errorf("%s line %d: %s", path, file.Errors[0].Line, file.Errors[0].Error)
+	}
+	// Codes are restored exactly as saved, however short or old. A code
+	// that would have to be renamed means the file is damaged, so the load
+	// is checked with a dry run and refused before anything changes.
+	opts := importOptions{
+		Conflict:   conflictOverwrite,
+		DryRun:     true,
+		CheckCode:  func(string) error { return nil },
+		NewDomains: file.Domains,
+	}
+	report := us.importRecords(file.Links, file.Lines, opts)
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%s line %d: %s", path, report.Errors[0].Line, report.Errors[0].Error)
+	}
+	if len(report.Renamed) > 0 {
+		r := report.Renamed[0]
+		return fmt.Errorf("%s: cannot restore code %q: %s", path, r.From, r.Reason)
+	}
+	us.mu.RLock()
+	for i, rec := range file.Domains {
+		if d, ok := us.domains[rec.Host]; ok && d.RootRedirect != "" {
+			file.Domains[i].RootRedirect = d.RootRedirect
+		}
+	}
+	us.mu.RUnlock()
+	us.importDomains(file.Domains, true, false)
+	us.importWorkspaces(file.Workspaces, true, false)
+	us.importWebhooks(file.Webhooks, true, false)
+	opts.DryRun = false
+	report = us.importRecords(file.Links, file.Lines, opts)
+	slog.Info("Snapshot loaded", "path", path, "domains", len(file.Domains), "workspaces", len(file.Workspaces),
+		"webhooks", len(file.Webhooks), "links", report.Imported)
+	return nil
+}
+
+// SaveSnapshot writes every domain, workspace, webhook and link, with their
+// counters, to path in the export format. The file is replaced atomically so
+// a crash mid-write leaves the previous snapshot intact.
+func (us *URLShortener) SaveSnapshot(path string) error {
+	err := us.saveSnapshot(path)
+	if s := us.snapshot; s != nil && s.path == path {
+		s.mu.Lock()
+		if s.err = err; err == nil {
+			s.saved = time.Now()
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (us *URLShortener) saveSnapshot(path string) error {
+	file := &exportFile{
+		Domains:    us.exportDomains(),
+		Workspaces: us.exportWorkspaces(),
+		Webhooks:   us.exportWebhooks(),
+		Links:      us.exportRecords(),
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := writeExport(w, file); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// StartSnapshots saves a snapshot to path once per interval, so a crash
+// loses at most that much. A final snapshot is taken on shutdown.
+func (us *URLShortener) StartSnapshots(path string, interval time.Duration) {
+	us.snapshot = &snapshotStatus{path: path}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := us.SaveSnapshot(path); err != nil {
+				slog.Error("Saving snapshot failed", "path", path, "err", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often the certificate files are checked for
+// changes.
+const certReloadInterval = 10 * time.Second
+
+// certReloader serves a certificate and key pair from disk, picking up
+// renewed files without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // newest modification time of the two files
+}
+
+// newCertReloader loads the pair and starts watching it for changes.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := cr.reload(); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(certReloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reloaded, err := cr.reload()
+			switch {
+			case err != nil:
+				slog.Error("Reloading TLS certificate failed, keeping the current one", "cert", certFile, "err", err)
+			case reloaded:
+				slog.Info("TLS certificate reloaded", "cert", certFile)
+			}
+		}
+	}()
+	return cr, nil
+}
+
+// reload loads the pair again if either file changed since the last load.
+func (cr *certReloader) reload() (bool, error) {
+	modTime, err := newestModTime(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, err
+	}
+	cr.mu.RLock()
+	unchanged := cr.cert != nil && modTime.Equal(cr.modTime)
+	cr.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, err
+	}
+	cr.mu.Lock()
+	cr.cert, cr.modTime = &cert, modTime
+	cr.mu.Unlock()
+	return true, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+func newestModTime(paths ...string) (time.Time, error) {
+	var newest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// withHSTS tells browsers to use HTTPS for the host from now on.
+func withHSTS(maxAge time.Duration, next http.Handler) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpsRedirect is the plain HTTP listener's handler when TLS is on. It
+// sends visitors to the same URL over HTTPS on tlsPort. With serveLinks
+// set, short links and the health probes are served directly instead, so
+// old http:// links skip a hop.
+func httpsRedirect(tlsPort string, serveLinks bool, mux *http.ServeMux, app http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		probe := pattern == "/healthz" || pattern == "/readyz"
+		shortLink := pattern == "/" && r.URL.Path != "/"
+		if probe || (serveLinks && shortLink) {
+			app.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(net.JoinHostPort(strings.Trim(host, "[]"), tlsPort), ":443")
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
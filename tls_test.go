@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned writes a fresh self-signed certificate for localhost with
+// the given common name, and returns it parsed.
+func writeSelfSigned(t *testing.T, certFile, keyFile, commonName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// touch moves the modification time of files forward, as a renewal would.
+func touch(t *testing.T, when time.Time, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		if err := os.Chtimes(p, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName handshakes with the reloader's certificate and returns
+// the common name the client saw.
+func servedCommonName(t *testing.T, cr *certReloader, roots *x509.CertPool) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetCertificate: cr.GetCertificate}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// httptest adds its own certificate, which only a client without SNI
+	// gets instead of the reloader's.
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := writeSelfSigned(t, certFile, keyFile, "first")
+	touch(t, time.Now().Add(-time.Minute), certFile, keyFile)
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	if cn := servedCommonName(t, cr, roots); cn != "first" {
+		t.Fatalf("served %q, want first", cn)
+	}
+
+	if reloaded, err := cr.reload(); err != nil || reloaded {
+		t.Errorf("reload of unchanged files = %v, %v; want false, nil", reloaded, err)
+	}
+
+	// A renewal replaces both files.
+	second := writeSelfSigned(t, certFile, keyFile, "second")
+	touch(t, time.Now(), certFile, keyFile)
+	if reloaded, err := cr.reload(); err != nil || !reloaded {
+		t.Fatalf("reload after renewal = %v, %v; want true, nil", reloaded, err)
+	}
+	roots.AddCert(second)
+	if cn := servedCommonName(t, cr, roots); cn != "second" {
+		t.Errorf("served %q after renewal, want second", cn)
+	}
+
+	// A half-written renewal keeps the current certificate.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, time.Now().Add(time.Minute), keyFile)
+	if reloaded, err := cr.reload(); err == nil || reloaded {
+		t.Errorf("reload of a broken key = %v, %v; want an error", reloaded, err)
+	}
+	if cn := servedCommonName(t, cr, roots); cn != "second" {
+		t.Errorf("served %q after a failed reload, want second", cn)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Error("newCertReloader succeeded without certificate files")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	for _, pattern := range []string{"/", "/stats/", "/healthz", "/readyz"} {
+		mux.Handle(pattern, app)
+	}
+
+	tests := []struct {
+		name       string
+		tlsPort    string
+		serveLinks bool
+		url        string
+		wantStatus int
+		wantTarget string
+	}{
+		{name: "home page", tlsPort: "443", url: "http://example.com/", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com/"},
+		{name: "query kept", tlsPort: "443", url: "http://example.com:80/stats/abc?domain=x", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com/stats/abc?domain=x"},
+		{name: "other port", tlsPort: "8443", url: "http://example.com:8080/stats/abc", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com:8443/stats/abc"},
+		{name: "ipv6", tlsPort: "8443", url: "http://[::1]:8080/", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://[::1]:8443/"},
+		{name: "short link", tlsPort: "443", url: "http://example.com/abc", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com/abc"},
+		{name: "short link served", tlsPort: "443", serveLinks: true, url: "http://example.com/abc", wantStatus: http.StatusTeapot},
+		{name: "home page with links served", tlsPort: "443", serveLinks: true, url: "http://example.com/", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com/"},
+		{name: "stats with links served", tlsPort: "443", serveLinks: true, url: "http://example.com/stats/abc", wantStatus: http.StatusPermanentRedirect, wantTarget: "https://example.com/stats/abc"},
+		{name: "liveness probe", tlsPort: "443", url: "http://example.com/healthz", wantStatus: http.StatusTeapot},
+		{name: "readiness probe", tlsPort: "443", url: "http://example.com/readyz", wantStatus: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			httpsRedirect(tt.tlsPort, tt.serveLinks, mux, app).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantTarget {
+				t.Errorf("Location = %q, want %q", got, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestWithHSTS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	withHSTS(365*24*time.Hour, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("Strict-Transport-Security = %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	withHSTS(0, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q with HSTS off, want none", got)
+	}
+}
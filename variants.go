@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+)
+
+// Variant is one weighted destination of an A/B split link. Visitors that no
+// redirect rule matched are spread across the variants in proportion to
+// their weights.
+type Variant struct {
+	Name   string `json:"name,omitempty"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Clicks uint64 `json:"clicks,omitempty"`
+}
+
+// VariantStats is a single row of the variant breakdown on the stats page.
+type VariantStats struct {
+	Name    string
+	URL     string
+	Weight  int
+	Clicks  uint64
+	Percent float64 // share of all variant clicks
+}
+
+const (
+	variantCookiePrefix = "ab_"
+	variantCookieMaxAge = 30 * 24 * 60 * 60 // 30 days
+)
+
+// label returns the name used for the variant in cookies and stats.
+func (v Variant) label(i int) string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return fmt.Sprintf("variant %d", i+1)
+}
+
+// validateVariants checks variants supplied by a client before they are stored.
+func validateVariants(variants []Variant) error {
+	total := 0
+	seen := make(map[string]bool)
+	for i, v := range variants {
+		if v.URL == "" {
+			return fmt.Errorf("%s: url is required", v.label(i))
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("%s: weight must not be negative", v.label(i))
+		}
+		if seen[v.label(i)] {
+			return fmt.Errorf("variant name %q is already used", v.label(i))
+		}
+		seen[v.label(i)] = true
+		total += v.Weight
+	}
+	if len(variants) > 0 && total == 0 {
+		return fmt.Errorf("at least one variant needs a positive weight")
+	}
+	return nil
+}
+
+// pickVariant returns the index of the variant to serve. A visitor that
+// already has an assignment in their cookie keeps it as long as that variant
+// still exists and has weight; otherwise one is drawn by weight. The caller
+// must hold us.mu.
+func pickVariant(variants []Variant, assigned string) int {
+	total := 0
+	for i, v := range variants {
+		if v.Weight > 0 && v.label(i) == assigned {
+			return i
+		}
+		total += v.Weight
+	}
+
+	n := rand.Intn(total)
+	for i, v := range variants {
+		if n < v.Weight {
+			return i
+		}
+		n -= v.Weight
+	}
+	return len(variants) - 1
+}
+
+// variantCookie returns the cookie that keeps a visitor on the same variant.
+func variantCookie(code, label string) *http.Cookie {
+	return &http.Cookie{
+		Name:     variantCookiePrefix + code,
+		Value:    url.QueryEscape(label),
+		Path:     "/" + code,
+		MaxAge:   variantCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// assignedVariant reads the visitor's existing assignment for code, if any.
+func assignedVariant(r *http.Request, code string) string {
+	c, err := r.Cookie(variantCookiePrefix + code)
+	if err != nil {
+		return ""
+	}
+	label, err := url.QueryUnescape(c.Value)
+	if err != nil {
+		return ""
+	}
+	return label
+}
+
+// variantStats builds the per-variant breakdown shown on the stats page.
+func variantStats(data *URLData) []VariantStats {
+	if len(data.Variants) == 0 {
+		return nil
+	}
+	var total uint64
+	for _, v := range data.Variants {
+		total += v.Clicks
+	}
+	stats := make([]VariantStats, len(data.Variants))
+	for i, v := range data.Variants {
+		stats[i] = VariantStats{Name: v.label(i), URL: v.URL, Weight: v.Weight, Clicks: v.Clicks}
+		if total > 0 {
+			stats[i].Percent = float64(v.Clicks) * 100 / float64(total)
+		}
+	}
+	return stats
+}
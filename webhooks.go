@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook event types.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+var webhookEvents = map[string]bool{
+	EventLinkCreated: true,
+	EventLinkUpdated: true,
+	EventLinkDeleted: true,
+	EventLinkClicked: true,
+}
+
+const (
+	webhookQueueSize   = 10000
+	webhookWorkers     = 4
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 6
+	webhookBaseBackoff = 5 * time.Second // doubled after every failed attempt
+	webhookLogSize     = 500
+	webhookDeadSize    = 1000
+)
+
+// Webhook is a subscription to link events. Payloads are signed with
+// Secret, which is only returned when the webhook is created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`              // empty means every event
+	Workspace string    `json:"workspace,omitempty"` // only events for this workspace's links
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// validate checks the webhook's URL and events.
+func (h *Webhook) validate() error {
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("a valid http(s) url is required")
+	}
+	for _, e := range h.Events {
+		if !webhookEvents[e] {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
+
+// wants reports whether the webhook subscribes to an event.
+func (h *Webhook) wants(event webhookEvent) bool {
+	if h.Workspace != "" && h.Workspace != event.workspace {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookEvent is the JSON body sent to subscribers.
+type webhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+
+	workspace string
+}
+
+// webhookLink describes the link an event is about.
+type webhookLink struct {
+	Code      string   `json:"code"`
+	Domain    string   `json:"domain,omitempty"`
+	ShortURL  string   `json:"short_url"`
+	LongURL   string   `json:"long_url"`
+	Workspace string   `json:"workspace,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// webhookClick adds what is known about a visitor to a click event. The
+// visitor's IP address is never sent.
+type webhookClick struct {
+	webhookLink
+	Target  string `json:"target"`
+	Browser string `json:"browser,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// webhookDelivery is one event on its way to one webhook.
+type webhookDelivery struct {
+	ID       string    `json:"id"`
+	Webhook  string    `json:"webhook"`
+	Event    string    `json:"event"`
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status,omitempty"` // HTTP status of the last attempt
+	Error    string    `json:"error,omitempty"`
+	LastTry  time.Time `json:"last_try"`
+
+	body []byte
+}
+
+// webhookDispatcher delivers events in the background so that handlers,
+// and the redirect path in particular, never wait on subscribers. It has its
+// own lock and never takes URLShortener.mu.
+type webhookDispatcher struct {
+	mu     sync.Mutex
+	hooks  map[string]*Webhook
+	log    []webhookDelivery // latest attempts, oldest first
+	dead   []webhookDelivery // deliveries that ran out of attempts
+	queue  chan *webhookDelivery
+	client *http.Client
+}
+
+func newWebhookDispatcher() *webhookDispatcher {
+	d := &webhookDispatcher{
+		hooks:  make(map[string]*Webhook),
+		queue:  make(chan *webhookDelivery, webhookQueueSize),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		go d.worker()
+	}
+	return d
+}
+
+// emit queues an event for every webhook that wants it. It never blocks.
+func (d *webhookDispatcher) emit(event webhookEvent) {
+	d.mu.Lock()
+	var targets []*Webhook
+	for _, h := range d.hooks {
+		if h.wants(event) {
+			targets = append(targets, h)
+		}
+	}
+	d.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	event.ID = randomToken(8)
+	event.CreatedAt = time.Now().UTC()
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Encoding webhook event failed", "type", event.Type, "err", err)
+		return
+	}
+	for _, h := range targets {
+		d.enqueue(&webhookDelivery{ID: randomToken(8), Webhook: h.ID, Event: event.Type, body: body})
+	}
+}
+
+func (d *webhookDispatcher) enqueue(delivery *webhookDelivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		delivery.Error = "queue full"
+		d.bury(delivery)
+	}
+}
+
+func (d *webhookDispatcher) worker() {
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver makes one attempt and schedules a retry with exponential backoff
+// if it fails.
+func (d *webhookDispatcher) deliver(delivery *webhookDelivery) {
+	d.mu.Lock()
+	hook, ok := d.hooks[delivery.Webhook]
+	d.mu.Unlock()
+	if !ok {
+		return // the webhook was deleted
+	}
+
+	delivery.Attempts++
+	delivery.LastTry = time.Now().UTC()
+	delivery.Status, delivery.Error = 0, ""
+	if err := d.post(hook, delivery); err != nil {
+		delivery.Error = err.Error()
+	}
+	d.record(*delivery)
+
+	if delivery.Error == "" {
+		return
+	}
+	if delivery.Attempts >= webhookMaxAttempts {
+		d.bury(delivery)
+		return
+	}
+	backoff := webhookBaseBackoff << (delivery.Attempts - 1)
+	time.AfterFunc(backoff, func() { d.enqueue(delivery) })
+}
+
+// post sends a delivery, signed with the webhook's secret.
+func (d *webhookDispatcher) post(hook *Webhook, delivery *webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(delivery.LastTry.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortner-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(hook.Secret, timestamp, delivery.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	delivery.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.body". Receivers
+// should recompute it and reject stale timestamps to prevent replays.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record appends an attempt to the delivery log.
+func (d *webhookDispatcher) record(delivery webhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, delivery)
+	if len(d.log) > webhookLogSize {
+		d.log = d.log[len(d.log)-webhookLogSize:]
+	}
+}
+
+// bury moves a delivery to the dead-letter list.
+func (d *webhookDispatcher) bury(delivery *webhookDelivery) {
+	slog.Warn("Webhook delivery failed for good", "delivery", delivery.ID, "webhook", delivery.Webhook, "err", delivery.Error)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dead = append(d.dead, *delivery)
+	if len(d.dead) > webhookDeadSize {
+		d.dead = d.dead[len(d.dead)-webhookDeadSize:]
+	}
+}
+
+// webhookLink describes a link for an event. The caller must hold us.mu.
+func (us *URLShortener) webhookLink(key linkKey, data *URLData) webhookLink {
+	return webhookLink{
+		Code:      key.Code,
+		Domain:    key.Domain,
+		ShortURL:  us.shortURL(key),
+		LongURL:   data.LongURL,
+		Workspace: data.Workspace,
+		Tags:      data.Tags,
+	}
+}
+
+// emitLinkEvent sends a lifecycle event for a link. The caller must hold
+// us.mu.
+func (us *URLShortener) emitLinkEvent(eventType string, key linkKey, data *URLData) {
+	us.webhooks.emit(webhookEvent{Type: eventType, Data: us.webhookLink(key, data), workspace: data.Workspace})
+}
+
+// HandleWebhooks manages webhook subscriptions:
+//
+//	GET    /admin/webhooks                    list webhooks
+//	POST   /admin/webhooks                    subscribe a URL, returns its secret
+//	DELETE /admin/webhooks/{id}               unsubscribe
+//	GET    /admin/webhooks/{id}/deliveries    recent delivery attempts
+//	GET    /admin/webhooks/dead               deliveries that ran out of retries
+//	POST   /admin/webhooks/dead/retry         queue every dead delivery again
+func (us *URLShortener) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !us.requireAdmin(w, r) {
+		return
+	}
+	d := us.webhooks
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/webhooks"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		d.mu.Lock()
+		hooks := make([]Webhook, 0, len(d.hooks))
+		for _, h := range d.hooks {
+			hook := *h
+			hook.Secret = ""
+			hooks = append(hooks, hook)
+		}
+		d.mu.Unlock()
+		sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hooks)
+
+	case parts[0] == "" && r.Method == http.MethodPost:
+		var hook Webhook
+		if !decodeJSON(w, r, &hook) {
+			return
+		}
+		if err := hook.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hook.ID = randomToken(8)
+		hook.Secret = randomToken(24)
+		hook.CreatedAt = time.Now().UTC()
+		d.mu.Lock()
+		d.hooks[hook.ID] = &hook
+		d.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hook)
+
+	case parts[0] == "dead" && len(parts) == 1 && r.Method == http.MethodGet:
+		d.mu.Lock()
+		dead := append([]webhookDelivery{}, d.dead...)
+		d.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dead)
+
+	case parts[0] == "dead" && len(parts) == 2 && parts[1] == "retry" && r.Method == http.MethodPost:
+		d.mu.Lock()
+		dead := d.dead
+		d.dead = nil
+		d.mu.Unlock()
+		for i := range dead {
+			delivery := dead[i]
+			delivery.Attempts = 0
+			d.enqueue(&delivery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"queued": len(dead)})
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		d.mu.Lock()
+		_, ok := d.hooks[parts[0]]
+		delete(d.hooks, parts[0])
+		d.mu.Unlock()
+		if !ok {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		d.mu.Lock()
+		deliveries := []webhookDelivery{}
+		for i := len(d.log) - 1; i >= 0; i-- {
+			if d.log[i].Webhook == parts[0] {
+				deliveries = append(deliveries, d.log[i])
+			}
+		}
+		d.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Role is a member's permission level within a workspace.
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // can see history and stats
+	RoleEditor Role = "editor" // can also create, edit and delete links
+	RoleOwner  Role = "owner"  // can also manage members
+)
+
+// roleRank orders roles so that a higher role includes the lower ones.
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// workspaceKeyCookie holds a member key for the web UI.
+const workspaceKeyCookie = "workspace_key"
+
+// Workspace groups links that a team manages together.
+type Workspace struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	CreatedAt time.Time          `json:"created_at"`
+	Members   map[string]*Member `json:"members"` // member name -> member
+}
+
+// Member is someone with access to a workspace. Members authenticate with a
+// secret key, of which only the SHA-256 hash is kept.
+type Member struct {
+	Name    string    `json:"name"`
+	Role    Role      `json:"role"`
+	KeyHash string    `json:"key_hash"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// memberRef locates a member from their key hash.
+type memberRef struct {
+	Workspace string
+	Name      string
+}
+
+// workspaceRequest is the body for creating a workspace or adding a member.
+type workspaceRequest struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner,omitempty"`
+	Role  Role   `json:"role,omitempty"`
+}
+
+// memberResponse returns a member, including their key when it was just
+// issued. Keys cannot be retrieved later.
+type memberResponse struct {
+	Workspace string `json:"workspace"`
+	Name      string `json:"name"`
+	Role      Role   `json:"role"`
+	Key       string `json:"key,omitempty"`
+}
+
+// allows reports whether the role includes the permissions of need.
+func (r Role) allows(need Role) bool {
+	return roleRank[r] >= roleRank[need]
+}
+
+// randomToken returns n random bytes, hex encoded.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestKey returns the member key sent with the request, either as a
+// bearer token or in the web UI's cookie.
+func requestKey(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return key
+	}
+	if c, err := r.Cookie(workspaceKeyCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// member returns the requester's membership in workspace, if any. The
+// caller must hold us.mu.
+func (us *URLShortener) member(r *http.Request, workspace string) *Member {
+	key := requestKey(r)
+	if key == "" {
+		return nil
+	}
+	ref, ok := us.memberKeys[hashKey(key)]
+	if !ok || ref.Workspace != workspace {
+		return nil
+	}
+	return us.workspaces[workspace].Members[ref.Name]
+}
+
+// hasRole reports whether the requester is a member of workspace with at
+// least the given role. The caller must hold us.mu.
+func (us *URLShortener) hasRole(r *http.Request, workspace string, need Role) bool {
+	m := us.member(r, workspace)
+	return m != nil && m.Role.allows(need)
+}
+
+// canView reports whether the requester may see a link's stats. Personal
+// links stay public to anyone with the code; workspace links need a member.
+// The caller must hold us.mu.
+func (us *URLShortener) canView(r *http.Request, data *URLData) bool {
+	if data.Workspace == "" || us.isAdmin(r) {
+		return true
+	}
+	return us.hasRole(r, data.Workspace, RoleViewer)
+}
+
+// canEdit reports whether the requester may edit or delete a link: an editor
+// of its workspace, or for personal links the IP that created it. The caller
+// must hold us.mu.
+func (us *URLShortener) canEdit(r *http.Request, data *URLData) bool {
+	if us.isAdmin(r) {
+		return true
+	}
+	if data.Workspace != "" {
+		return us.hasRole(r, data.Workspace, RoleEditor)
+	}
+	return data.CreatorIP != "" && data.CreatorIP == us.clientIP(r)
+}
+
+// errForbidden is returned when the requester lacks the role an action needs.
+var errForbidden = errors.New("you need the editor role in this workspace")
+
+// checkCreate checks that the requester may create links in workspace. The
+// caller must hold us.mu.
+func (us *URLShortener) checkCreate(r *http.Request, workspace string) error {
+	if workspace == "" {
+		return nil
+	}
+	if _, ok := us.workspaces[workspace]; !ok {
+		return fmt.Errorf("workspace %q not found", workspace)
+	}
+	if !us.hasRole(r, workspace, RoleEditor) && !us.isAdmin(r) {
+		return errForbidden
+	}
+	return nil
+}
+
+// addMember adds or updates a member and returns their new key, if one was
+// issued. Existing members keep their key when their role changes. The
+// caller must hold us.mu.
+func (us *URLShortener) addMember(ws *Workspace, name string, role Role) string {
+	if m, ok := ws.Members[name]; ok {
+		m.Role = role
+		return ""
+	}
+	key := randomToken(24)
+	m := &Member{Name: name, Role: role, KeyHash: hashKey(key), AddedAt: time.Now()}
+	ws.Members[name] = m
+	us.memberKeys[m.KeyHash] = memberRef{Workspace: ws.ID, Name: name}
+	return key
+}
+
+// HandleWorkspaces routes the workspace API:
+//
+//	POST   /workspaces                        create a workspace and its owner
+//	POST   /workspaces/login                  store a member key in a cookie
+//	GET    /workspaces/{id}                   show a workspace (viewer)
+//	POST   /workspaces/{id}/members           add a member or change a role (owner)
+//	DELETE /workspaces/{id}/members/{name}    remove a member (owner)
+func (us *URLShortener) HandleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/workspaces"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodPost:
+		us.createWorkspace(w, r)
+	case parts[0] == "login" && r.Method == http.MethodPost:
+		us.workspaceLogin(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		us.showWorkspace(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodPost:
+		us.saveMember(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "members" && r.Method == http.MethodDelete:
+		us.removeMember(w, r, parts[0], parts[2])
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func (us *URLShortener) createWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req workspaceRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Owner = strings.TrimSpace(req.Owner)
+	if req.Name == "" || req.Owner == "" {
+		http.Error(w, "name and owner are required", http.StatusBadRequest)
+		return
+	}
+
+	ws := &Workspace{ID: randomToken(8), Name: req.Name, CreatedAt: time.Now(), Members: make(map[string]*Member)}
+	us.mu.Lock()
+	us.workspaces[ws.ID] = ws
+	key := us.addMember(ws, req.Owner, RoleOwner)
+	us.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(memberResponse{Workspace: ws.ID, Name: req.Owner, Role: RoleOwner, Key: key})
+}
+
+// workspaceLogin lets the web UI act as a member by storing their key in a
+// cookie, then shows the workspace's history.
+func (us *URLShortener) workspaceLogin(w http.ResponseWriter, r *http.Request) {
+	key := r.FormValue("key")
+	us.mu.RLock()
+	ref, ok := us.memberKeys[hashKey(key)]
+	us.mu.RUnlock()
+	if !ok {
+		http.Error(w, "Unknown key", http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     workspaceKeyCookie,
+		Value:    key,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/history?workspace="+ref.Workspace, http.StatusSeeOther)
+}
+
+func (us *URLShortener) showWorkspace(w http.ResponseWriter, r *http.Request, id string) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	ws, ok := us.workspaces[id]
+	if !ok {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+	if !us.hasRole(r, id, RoleViewer) && !us.isAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	members := make([]memberResponse, 0, len(ws.Members))
+	for _, m := range ws.Members {
+		members = append(members, memberResponse{Workspace: id, Name: m.Name, Role: m.Role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ID      string           `json:"id"`
+		Name    string           `json:"name"`
+		Members []memberResponse `json:"members"`
+	}{ws.ID, ws.Name, members})
+}
+
+func (us *URLShortener) saveMember(w http.ResponseWriter, r *http.Request, id string) {
+	var req workspaceRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := roleRank[req.Role]; !ok {
+		http.Error(w, "role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	ws, ok := us.workspaces[id]
+	if !ok {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+	if !us.hasRole(r, id, RoleOwner) && !us.isAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if m, ok := ws.Members[req.Name]; ok && m.Role == RoleOwner && req.Role != RoleOwner && ws.owners() == 1 {
+		http.Error(w, "A workspace needs at least one owner", http.StatusConflict)
+		return
+	}
+	key := us.addMember(ws, req.Name, req.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(memberResponse{Workspace: id, Name: req.Name, Role: req.Role, Key: key})
+}
+
+func (us *URLShortener) removeMember(w http.ResponseWriter, r *http.Request, id, name string) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	ws, ok := us.workspaces[id]
+	if !ok {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+	if !us.hasRole(r, id, RoleOwner) && !us.isAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	m, ok := ws.Members[name]
+	if !ok {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	if m.Role == RoleOwner && ws.owners() == 1 {
+		http.Error(w, "A workspace needs at least one owner", http.StatusConflict)
+		return
+	}
+	delete(ws.Members, name)
+	delete(us.memberKeys, m.KeyHash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// owners counts the workspace's owners.
+func (ws *Workspace) owners() int {
+	n := 0
+	for _, m := range ws.Members {
+		if m.Role == RoleOwner {
+			n++
+		}
+	}
+	return n
+}